@@ -0,0 +1,77 @@
+package crawler
+
+import (
+	"net/url"
+	"time"
+)
+
+// Asset is a page asset (img, css, script). Only URL is set unless assets are
+// verified, see Crawler.VerifyAssets.
+type Asset struct {
+	URL  *url.URL
+	Kind AssetKind
+
+	// StatusCode is the HTTP status code of the final response for the asset,
+	// or zero if there was none.
+	StatusCode int
+	// ContentType and ContentLength are from the response headers. The length
+	// is -1 if it is not known.
+	ContentType   string
+	ContentLength int64
+	// Duration is how long the request for the asset took.
+	Duration time.Duration
+	// Err is why the asset could not be retrieved.
+	Err error
+
+	// Assets are the resources a stylesheet references with url() and @import,
+	// if stylesheets are crawled, see Crawler.CrawlStylesheets.
+	Assets []Asset
+	// Via is the stylesheet that references the asset, for assets that a page
+	// only uses through its stylesheets.
+	Via *url.URL
+}
+
+// Verified reports whether a request for the asset was made.
+func (a Asset) Verified() bool {
+	return a.StatusCode != 0 || a.Err != nil
+}
+
+// Broken reports whether the asset was verified and could not be retrieved.
+func (a Asset) Broken() bool {
+	return a.Err != nil
+}
+
+// verifyAssets requests each unique asset of the fetched pages once with checker,
+// making at most maxRequests simultaneous requests, and records the outcome on
+// the assets of every page. Assets on the crawled hosts that robots.txt disallows
+// are left unverified.
+func (cs *crawlerState) verifyAssets(checker *httpFetcher, maxRequests int) {
+	pm := cs.pageMap
+	var urls []*url.URL
+	seen := map[string]bool{}
+	for _, p := range pm.pages {
+		for _, a := range p.(*page).assets {
+			if k := a.URL.String(); !seen[k] {
+				seen[k] = true
+				if pm.inHost(a.URL) && !pm.robots.allowed(a.URL) {
+					continue
+				}
+				urls = append(urls, a.URL)
+			}
+		}
+	}
+
+	results := cs.checkAll(checker, maxRequests, urls)
+	for _, p := range cs.pageMap.pages {
+		p := p.(*page)
+		for i, a := range p.assets {
+			if r := results[a.URL.String()]; r != nil {
+				p.assets[i].StatusCode = r.statusCode
+				p.assets[i].ContentType = r.header.Get("Content-Type")
+				p.assets[i].ContentLength = r.contentLength
+				p.assets[i].Duration = r.duration
+				p.assets[i].Err = r.err
+			}
+		}
+	}
+}
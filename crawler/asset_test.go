@@ -0,0 +1,118 @@
+package crawler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCrawlerVerifyAssets(t *testing.T) {
+	var lock sync.Mutex
+	requests := map[string]int{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requests[r.Method+" "+r.URL.Path]++
+		lock.Unlock()
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<html><head><link href="style.css" rel="stylesheet"><script src="missing.js"></script></head>
+<body><a href="/page">Page</a><img src="logo.png"></body></html>`))
+		case "/page":
+			w.Write([]byte(`<html><head><link href="style.css" rel="stylesheet"></head><body><img src="missing.png"></body></html>`))
+		case "/style.css":
+			w.Header().Set("Content-Type", "text/css")
+			w.Write([]byte("body { color: black }"))
+		case "/logo.png":
+			if r.Method == "HEAD" {
+				w.WriteHeader(405)
+				return
+			}
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("PNG"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	c := NewCrawler(2, nil)
+	c.VerifyAssets = true
+	cr, err := c.Crawl(ts.URL + "/")
+	assert.NoError(t, err)
+
+	assets := map[string]Asset{}
+	for _, a := range cr.Root().Assets() {
+		assets[a.URL.Path] = a
+	}
+	style := assets["/style.css"]
+	assert.True(t, style.Verified())
+	assert.False(t, style.Broken())
+	assert.Equal(t, 200, style.StatusCode)
+	assert.Equal(t, "text/css", style.ContentType)
+	assert.Equal(t, int64(21), style.ContentLength)
+	assert.True(t, style.Duration > 0)
+	assert.Equal(t, 200, assets["/logo.png"].StatusCode, "GET is used if HEAD fails")
+	assert.True(t, assets["/missing.js"].Broken())
+	assert.Equal(t, 1, requests["HEAD /style.css"], "each asset is requested once")
+	assert.Equal(t, 0, requests["GET /style.css"])
+
+	lt := cr.LookupTable()
+	assert.Equal(t, []AssetRecord{{ts.URL + "/missing.js", 404, "status code received: 404"}}, lt[ts.URL+"/"].BrokenAssets)
+	assert.Equal(t, []AssetRecord{{ts.URL + "/missing.png", 404, "status code received: 404"}}, lt[ts.URL+"/page"].BrokenAssets)
+}
+
+func TestCrawlerVerifyAssetsPolite(t *testing.T) {
+	var lock sync.Mutex
+	var checks []time.Time
+	requested := map[string]bool{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requested[r.URL.Path] = true
+		if r.Method == "HEAD" {
+			checks = append(checks, time.Now())
+		}
+		lock.Unlock()
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nDisallow: /private/\n"))
+		case "/":
+			w.Write([]byte(`<html><body><img src="/logo.png"><img src="/icon.png"><img src="/private/secret.png"></body></html>`))
+		default:
+			w.Write([]byte("PNG"))
+		}
+	}))
+	defer ts.Close()
+
+	delay := 50 * time.Millisecond
+	c := NewCrawler(4, nil)
+	c.RespectRobots = true
+	c.VerifyAssets = true
+	c.RateLimit = RateLimit{Delay: delay}
+	cr, err := c.Crawl(ts.URL + "/")
+	assert.NoError(t, err)
+
+	assert.False(t, requested["/private/secret.png"], "assets disallowed by robots.txt are not requested")
+	for _, a := range cr.Root().Assets() {
+		assert.Equal(t, a.URL.Path != "/private/secret.png", a.Verified(), a.URL.Path)
+	}
+	if assert.Equal(t, 2, len(checks)) {
+		gap := checks[1].Sub(checks[0])
+		if gap < 0 {
+			gap = -gap
+		}
+		// allow for timer slack
+		assert.True(t, gap >= delay*8/10, "asset checks keep to the delay, gap %v", gap)
+	}
+}
+
+func TestAssetUnverified(t *testing.T) {
+	u, _ := url.Parse("http://testhost.local/style.css")
+	a := Asset{URL: u}
+	assert.False(t, a.Verified())
+	assert.False(t, a.Broken())
+}
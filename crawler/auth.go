@@ -0,0 +1,89 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Credentials authenticate the requests made to a single host. Requests to any
+// other host, including redirects away from it, are sent without them.
+type Credentials struct {
+	// Host is the host, with port if any, that the credentials are for. Case and
+	// the default port of the scheme are ignored, as they are for page URLs.
+	Host string
+	// Scheme is the scheme of the URLs the credentials are for. They are only sent
+	// over plain http if it is "http", so an https site does not give them away
+	// on a downgrade.
+	Scheme string
+	// Username and Password are sent with basic authentication if Username is set.
+	Username string
+	Password string
+	// BearerToken is sent in a bearer Authorization header if set. It takes
+	// precedence over basic authentication.
+	BearerToken string
+}
+
+// apply adds the credentials to req if it is for their host and scheme.
+func (c *Credentials) apply(req *http.Request) {
+	if c == nil || normalHost(req.URL, req.URL.Host) != normalHost(req.URL, c.Host) {
+		return
+	}
+	if req.URL.Scheme != "https" && req.URL.Scheme != c.Scheme {
+		return
+	}
+	switch {
+	case c.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+c.BearerToken)
+	case c.Username != "":
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+}
+
+// normalHost lower cases host and removes the default port of the scheme of u,
+// as URLNormalizer does.
+func normalHost(u *url.URL, host string) string {
+	host = strings.ToLower(host)
+	if port, ok := defaultPorts[u.Scheme]; ok {
+		host = strings.TrimSuffix(host, ":"+port)
+	}
+	return host
+}
+
+// formLogin posts a login form once, before the first request of a fetcher.
+type formLogin struct {
+	once sync.Once
+	err  error
+}
+
+// login posts the login form of the options, if any. The session cookies it sets are
+// kept in the cookie jar of the client. It is only done once, and every later call
+// returns the error of the first.
+func (f *httpFetcher) login(ctx context.Context) error {
+	if f.opts.LoginURL == "" {
+		return nil
+	}
+	f.formLogin.once.Do(func() {
+		req, err := http.NewRequest("POST", f.opts.LoginURL, strings.NewReader(f.opts.LoginForm.Encode()))
+		if err != nil {
+			f.formLogin.err = err
+			return
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		f.setHeaders(req)
+		res, err := f.client.Do(req.WithContext(ctx))
+		if err != nil {
+			f.formLogin.err = fmt.Errorf("login failed: %v", err)
+			return
+		}
+		res.Body.Close()
+		// a successful login usually redirects, which is not followed
+		if res.StatusCode >= 400 {
+			f.formLogin.err = fmt.Errorf("login failed: status code received: %v", res.StatusCode)
+		}
+	})
+	return f.formLogin.err
+}
@@ -0,0 +1,124 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCredentials(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "alice" || pass != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("<html><body><a href=\"page1.html\"></a></body></html>"))
+	}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+
+	r := NewHTTPFetcher(nil, HTTPOptions{}).Fetch(context.Background(), u)
+	assert.Error(t, r.Err, "the page needs credentials")
+
+	creds := &Credentials{Host: "otherhost.local", Username: "alice", Password: "s3cret"}
+	r = NewHTTPFetcher(nil, HTTPOptions{Credentials: creds}).Fetch(context.Background(), u)
+	assert.Error(t, r.Err, "credentials are only sent to their host")
+
+	creds.Host = u.Host
+	r = NewHTTPFetcher(nil, HTTPOptions{Credentials: creds}).Fetch(context.Background(), u)
+	assert.Error(t, r.Err, "credentials are not sent over http unless they are for http")
+
+	creds.Scheme = "http"
+	f := NewHTTPFetcher(nil, HTTPOptions{Credentials: creds})
+	r = f.Fetch(context.Background(), u)
+	assert.NoError(t, r.Err)
+
+	c := NewCrawler(1, f)
+	cr, _ := c.Crawl(ts.URL)
+	bs, _ := json.Marshal(cr.LookupTable())
+	assert.NotContains(t, string(bs), "s3cret", "credentials do not appear in the output")
+}
+
+func TestCredentialsHost(t *testing.T) {
+	creds := &Credentials{Host: "Docs.Example.com:80", Scheme: "http", BearerToken: "token"}
+	for _, tc := range []struct {
+		url  string
+		sent bool
+	}{
+		{"http://docs.example.com/", true},
+		{"http://DOCS.example.com:80/page", true},
+		{"https://docs.example.com/", false},
+		{"http://docs.example.com:8080/", false},
+		{"http://other.example.com/", false},
+	} {
+		req, _ := http.NewRequest("GET", tc.url, nil)
+		creds.apply(req)
+		assert.Equal(t, tc.sent, req.Header.Get("Authorization") != "", tc.url)
+	}
+}
+
+func TestCredentialsScheme(t *testing.T) {
+	for _, tc := range []struct {
+		scheme string
+		url    string
+		sent   bool
+	}{
+		{"https", "https://docs.example.com/", true},
+		{"https", "http://docs.example.com/", false},
+		{"http", "http://docs.example.com/", true},
+		{"http", "https://docs.example.com/", true},
+		{"", "http://docs.example.com/", false},
+		{"", "https://docs.example.com/", true},
+	} {
+		creds := &Credentials{Host: "docs.example.com", Scheme: tc.scheme, Username: "u", Password: "p"}
+		req, _ := http.NewRequest("GET", tc.url, nil)
+		creds.apply(req)
+		assert.Equal(t, tc.sent, req.Header.Get("Authorization") != "", "%s credentials on %s", tc.scheme, tc.url)
+	}
+}
+
+func TestFormLogin(t *testing.T) {
+	logins := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			logins++
+			if r.Method != "POST" || r.FormValue("user") != "alice" || r.FormValue("password") != "s3cret" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", Path: "/"})
+			http.Redirect(w, r, "/", http.StatusFound)
+			return
+		}
+		if c, err := r.Cookie("session"); err != nil || c.Value != "abc" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("<html><body></body></html>"))
+	}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL + "/")
+
+	f := NewHTTPFetcher(nil, HTTPOptions{
+		LoginURL:  ts.URL + "/login",
+		LoginForm: url.Values{"user": {"alice"}, "password": {"s3cret"}},
+	})
+	assert.NoError(t, f.Fetch(context.Background(), u).Err, "the session cookie is used")
+	assert.NoError(t, f.Fetch(context.Background(), u).Err)
+	assert.Equal(t, 1, logins, "the login is only done once")
+
+	f = NewHTTPFetcher(nil, HTTPOptions{
+		LoginURL:  ts.URL + "/login",
+		LoginForm: url.Values{"user": {"alice"}},
+	})
+	r := f.Fetch(context.Background(), u)
+	if assert.Error(t, r.Err) {
+		assert.Equal(t, "login failed: status code received: 403", r.Err.Error())
+	}
+}
@@ -1,22 +1,85 @@
 package crawler
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/url"
+	"sort"
 	"sync"
+	"time"
 )
 
 const defaultMaxRequests = 2
 
-// Fetcher is a function type that can fetch and fill out Page structures by some means.
-// The return value is slice of links. The crawler will then build the links in the page at
-// some time.
-type Fetcher func(p Page) []*url.URL
-
-// Asset is a URL to a page asset (img, css, script)
-type Asset *url.URL
-
-// Crawler is a basic single-domain website crawler.
+// Crawler is a basic website crawler. It crawls the host of the root URL, or
+// several hosts as selected by the HostMode of its Scope.
 type Crawler struct {
+	// MaxDepth is the maximum number of links between the root and a fetched page.
+	// Zero means no limit.
+	MaxDepth int
+	// MaxPages is the maximum number of pages that are fetched. Zero means no limit.
+	MaxPages int
+	// RespectRobots makes the crawler fetch robots.txt for each host and skip the
+	// pages it disallows for UserAgent.
+	RespectRobots bool
+	// RespectRobotsMeta makes the crawler honour robots meta tags, X-Robots-Tag
+	// headers and rel="nofollow" links. The links of nofollow pages and nofollow
+	// links are not followed, and noindex pages are marked, see Page.NoIndex.
+	RespectRobotsMeta bool
+	// UserAgent is the user agent name used to select robots.txt rules.
+	// DefaultUserAgent is used if it is empty.
+	UserAgent string
+	// Observer, if set, receives events as the crawl progresses.
+	Observer Observer
+	// Retry is the policy for retrying failed fetches. The zero value never retries.
+	Retry RetryPolicy
+	// Scope limits the crawl to parts of the hosts. The nil Scope crawls all of the
+	// host of the root URL.
+	Scope *Scope
+	// RateLimit throttles the fetches to each host. The robots.txt Crawl-delay
+	// for UserAgent is also honoured when RespectRobots is set.
+	RateLimit RateLimit
+	// CheckExternal makes the crawler check the external links once the crawl is
+	// done, with a HEAD request that falls back to GET, and record their status
+	// code and any error. Each unique URL is checked once. It has no effect on a
+	// lazy crawl.
+	CheckExternal bool
+	// VerifyAssets makes the crawler request each unique asset of the fetched pages
+	// once the crawl is done, with HEAD where possible, and record the outcome on
+	// the assets. Assets on the crawled hosts are only requested if robots.txt
+	// allows them. It has no effect on a lazy crawl.
+	VerifyAssets bool
+	// CrawlStylesheets makes the crawler fetch the stylesheets on the crawled
+	// hosts that the fetched pages use once the crawl is done, along with those
+	// they import. The fonts, images and stylesheets they reference are added to
+	// their assets, see Asset.Assets, and to the assets of the pages that use
+	// them. It has no effect on a lazy crawl.
+	CrawlStylesheets bool
+	// CheckRequests is the maximum number of simultaneous link checks, asset
+	// and stylesheet requests. Zero means the same as the crawl.
+	CheckRequests int
+	// Metadata selects the fields of the metadata of the fetched pages that are
+	// recorded, see Page.Meta. The status code is always recorded.
+	Metadata MetaField
+	// UseSitemaps makes the crawler read the sitemaps listed in the robots.txt of
+	// the root host, or its /sitemap.xml if there are none, before crawling.
+	// Every page they list within the crawl is crawled as another root, and the
+	// result reports on how the sitemaps match the links, see Result.Sitemap.
+	// It has no effect on a lazy crawl.
+	UseSitemaps bool
+	// SitemapURLs are further sitemaps to read, as with UseSitemaps.
+	SitemapURLs []string
+	// Normalizer maps the URLs that name the same page to the URL of the page,
+	// which is used for fetching it and in the results. DefaultNormalizer is used
+	// if it is nil.
+	Normalizer Normalizer
+	// Lazy makes Crawl return without fetching anything. Each page is fetched when
+	// its links or content are first asked for, so that only the parts of the site
+	// that are walked are crawled. EventCrawlFinished is not sent for a lazy crawl,
+	// as fetches go on for as long as the result is walked.
+	Lazy bool
+
 	maxRequests int
 	fetcher     Fetcher
 }
@@ -25,98 +88,454 @@ type Crawler struct {
 type PageRecord struct {
 	Links  []string `json:"links,omitempty"`
 	Assets []string `json:"assets,omitempty"`
-	Error  string   `json:"error,omitempty"`
+	// Edges describe the links that anything is known about.
+	Edges []EdgeRecord `json:"edges,omitempty"`
+	// BrokenAnchors are the links, with fragments, to anchors that the linked pages
+	// do not have.
+	BrokenAnchors []string `json:"brokenanchors,omitempty"`
+	// BrokenAssets are the assets that could not be retrieved, if assets were verified.
+	BrokenAssets []AssetRecord `json:"brokenassets,omitempty"`
+	Error        string        `json:"error,omitempty"`
+	Status       string        `json:"status,omitempty"`
+	// StatusCode is the HTTP status code of the final response, if any.
+	StatusCode int  `json:"statuscode,omitempty"`
+	Depth      int  `json:"depth"`
+	NoIndex    bool `json:"noindex,omitempty"`
+	// The metadata fields are only set if they were recorded, see Crawler.Metadata.
+	FinalURL      string `json:"finalurl,omitempty"`
+	ContentType   string `json:"contenttype,omitempty"`
+	ContentLength int64  `json:"contentlength,omitempty"`
+	// ResponseTime is in milliseconds.
+	ResponseTime float64  `json:"responsetime,omitempty"`
+	LastModified string   `json:"lastmodified,omitempty"`
+	ETag         string   `json:"etag,omitempty"`
+	Title        string   `json:"title,omitempty"`
+	Description  string   `json:"description,omitempty"`
+	Canonical    string   `json:"canonical,omitempty"`
+	Lang         string   `json:"lang,omitempty"`
+	H1           []string `json:"h1,omitempty"`
+	WordCount    int      `json:"wordcount,omitempty"`
+	// Alternates are the versions of the page in other languages.
+	Alternates []AlternateRecord `json:"alternates,omitempty"`
+	// Attempts is only set if the page was fetched more than once.
+	Attempts int `json:"attempts,omitempty"`
+
+	Redirects []RedirectRecord `json:"redirects,omitempty"`
+	Aliases   []string         `json:"aliases,omitempty"`
+}
+
+// setMeta sets the metadata fields of the record from m.
+func (pr *PageRecord) setMeta(m PageMeta) {
+	if m.URL != nil {
+		pr.FinalURL = m.URL.String()
+	}
+	pr.ContentType = m.ContentType
+	if m.ContentLength > 0 {
+		pr.ContentLength = m.ContentLength
+	}
+	pr.ResponseTime = float64(m.ResponseTime.Round(time.Microsecond)) / float64(time.Millisecond)
+	if !m.LastModified.IsZero() {
+		pr.LastModified = m.LastModified.UTC().Format(time.RFC3339)
+	}
+	pr.ETag = m.ETag
+	pr.Title = m.Title
+	pr.Description = m.Description
+	if m.Canonical != nil {
+		pr.Canonical = m.Canonical.String()
+	}
+	pr.Lang = m.Lang
+	pr.H1 = m.H1
+	pr.WordCount = m.WordCount
+	for _, a := range m.Alternates {
+		pr.Alternates = append(pr.Alternates, AlternateRecord{a.Lang, a.URL.String()})
+	}
+}
+
+// AlternateRecord is a marshalable record of an alternate version of a page.
+type AlternateRecord struct {
+	Lang string `json:"hreflang"`
+	URL  string `json:"url"`
+}
+
+// EdgeRecord is a marshalable record of a link.
+type EdgeRecord struct {
+	URL   string   `json:"url"`
+	Text  string   `json:"text,omitempty"`
+	Title string   `json:"title,omitempty"`
+	Rel   []string `json:"rel,omitempty"`
+	Path  string   `json:"path,omitempty"`
+	// Fragment is that of the link, the URL being that of the page.
+	Fragment string `json:"fragment,omitempty"`
+	// Region is omitted for links outside all regions.
+	Region string `json:"region,omitempty"`
+}
+
+// edgeRecord returns the record of e.
+func edgeRecord(e Edge) EdgeRecord {
+	er := EdgeRecord{
+		URL:      e.Page.URL().String(),
+		Text:     e.Text,
+		Title:    e.Title,
+		Rel:      e.Rel,
+		Path:     e.Path,
+		Fragment: e.Fragment,
+	}
+	if e.Region != RegionNone {
+		er.Region = e.Region.String()
+	}
+	return er
+}
+
+// AssetRecord is a marshalable record of a broken asset.
+type AssetRecord struct {
+	URL        string `json:"url"`
+	StatusCode int    `json:"statuscode,omitempty"`
+	Error      string `json:"error"`
+}
+
+// RedirectRecord is a marshalable record of a redirect hop.
+type RedirectRecord struct {
+	Status   int    `json:"status"`
+	Location string `json:"location"`
 }
 
 // Result provides access to the result of a crawl.
 type Result struct {
-	root   Page
-	pages  map[string]Page
-	lookup map[string]PageRecord
+	roots   []Page
+	robots  *Robots
+	sitemap *SitemapReport
+	pages   map[string]Page
+	lookup  map[string]PageRecord
 }
 
-// Root returns the root page for the crawl.
+// Root returns the root page for the crawl, the first seed of a crawl with several.
 func (cr *Result) Root() Page {
-	return cr.root
+	return cr.roots[0]
+}
+
+// Roots returns the page of each seed of the crawl, in order and without duplicates.
+func (cr *Result) Roots() []Page {
+	return cr.roots
+}
+
+// Robots returns the robots.txt rules the crawl respected for the host of the root,
+// or nil if robots.txt was not used.
+func (cr *Result) Robots() *Robots {
+	return cr.robots
+}
+
+// Sitemap returns the report on the sitemaps of the crawl, or nil if no
+// sitemaps were read.
+func (cr *Result) Sitemap() *SitemapReport {
+	return cr.sitemap
 }
 
 // LookupTable returns a page map/table that is suitable for serialization.
+// For a lazy crawl it covers the pages found up to the first call, and it must
+// not be called while pages are being fetched.
 func (cr *Result) LookupTable() map[string]PageRecord {
 	if cr.lookup != nil {
 		return cr.lookup
 	}
 	cr.lookup = map[string]PageRecord{}
 	for _, p := range cr.pages {
-		pr := PageRecord{}
-		if p.Error() == nil {
+		pr := PageRecord{Depth: p.Depth()}
+		if p.Attempts() > 1 {
+			pr.Attempts = p.Attempts()
+		}
+		if p.Status() != PageFetched {
+			pr.Status = p.Status().String()
+		} else if p.Error() == nil {
 			pr.Links = make([]string, len(p.Links()))
 			pr.Assets = make([]string, len(p.Assets()))
 
 			for i, a := range p.Assets() {
-				pr.Assets[i] = (*url.URL)(a).String()
+				pr.Assets[i] = a.URL.String()
+				if a.Broken() {
+					pr.BrokenAssets = append(pr.BrokenAssets, AssetRecord{a.URL.String(), a.StatusCode, a.Err.Error()})
+				}
 			}
 			for i, l := range p.Links() {
 				pr.Links[i] = l.URL().String()
 			}
+			for _, e := range p.Edges() {
+				if e.known() {
+					pr.Edges = append(pr.Edges, edgeRecord(e))
+				}
+				if e.BrokenAnchor() {
+					pr.BrokenAnchors = append(pr.BrokenAnchors, e.Page.URL().String()+"#"+e.Fragment)
+				}
+			}
+			pr.NoIndex = p.NoIndex()
 		} else {
 			pr.Error = p.Error().Error()
 		}
+		if p.Status() == PageExternal && p.Error() != nil {
+			pr.Error = p.Error().Error()
+		}
+		// asking other lazy pages would fetch them
+		if p.Status() == PageFetched || p.Status() == PageExternal {
+			pr.StatusCode = p.StatusCode()
+		}
+		if p.Status() == PageFetched {
+			pr.setMeta(p.Meta())
+		}
+		for _, r := range p.Redirects() {
+			pr.Redirects = append(pr.Redirects, RedirectRecord{r.StatusCode, r.URL.String()})
+		}
+		for _, a := range p.Aliases() {
+			pr.Aliases = append(pr.Aliases, a.String())
+		}
 		cr.lookup[p.URL().String()] = pr
 	}
 	cr.pages = nil
 	return cr.lookup
 }
 
+// ByHost groups the URLs of the LookupTable by host, each sorted.
+func (cr *Result) ByHost() map[string][]string {
+	hosts := map[string][]string{}
+	for k := range cr.LookupTable() {
+		u, err := url.Parse(k)
+		if err != nil {
+			continue
+		}
+		hosts[u.Host] = append(hosts[u.Host], k)
+	}
+	for _, urls := range hosts {
+		sort.Strings(urls)
+	}
+	return hosts
+}
+
 type sentinel struct{}
 
-// newPageMap is visited page memo that uses the HTTP request URI as key
-// and limits the map to only pages on a single host.
+// newPageMap is visited page memo that uses the host and HTTP request URI as key
+// and limits the map to only pages on the crawled hosts. It also decides which
+// pages are to be fetched, within the depth and page count limits.
 type pageMap struct {
-	host  string
-	lock  sync.Mutex
-	pages map[string]Page
+	inHost    func(u *url.URL) bool
+	normalize Normalizer
+	robots    *robotsCache
+	scope     *Scope
+	maxDepth  int
+	maxPages  int
+	queued    int
+	observer  Observer
+	// lazy pageMaps leave it to the pages to enqueue themselves when first used
+	lazy    bool
+	newPage func(u *url.URL) *page
+	lock    sync.Mutex
+	pages   map[string]Page
+}
+
+// discovered sends EventDiscovered for pages. It must not be called with the
+// lock held.
+func (pm *pageMap) discovered(pages []Page) {
+	if pm.observer == nil {
+		return
+	}
+	for _, p := range pages {
+		pm.observer.Observe(Event{Type: EventDiscovered, Page: p})
+	}
 }
 
 func newPageMap(host string) *pageMap {
 	return &pageMap{
-		host:  host,
-		pages: make(map[string]Page),
+		inHost:    func(u *url.URL) bool { return u.Host == host },
+		normalize: DefaultNormalizer,
+		newPage:   newEagerPage,
+		pages:     make(map[string]Page),
 	}
 }
 
-// getPages returns Page structs for all given links that are within the
-// host associated with this pageMap. The first returned slice is the
-// same length as links and contains a page instance for every link. The
-// second slice returned is a subset of the elements of the first slice,
-// containing all newly initialized pages.
-func (pm *pageMap) getPages(links []*url.URL) ([]Page, []Page) {
+// pageKey is the key of the page for the normalized URL u, which leaves out any
+// fragment.
+func pageKey(u *url.URL) string {
+	if u.Fragment == "" {
+		return u.String()
+	}
+	uu := *u
+	uu.Fragment = ""
+	return uu.String()
+}
+
+// getPages returns Page structs for all given absolute links. The links are those found
+// on the page from, or seed links at depth zero if from is nil. The first returned
+// slice contains a page instance for every link, with links to hosts outside those
+// associated with this pageMap as PageExternal pages. The second slice
+// returned is a subset of the elements of the first slice, containing all
+// pages that should now be fetched. Pages outside of the limits or the scope
+// are still returned in the first slice, but are never fetched. Seed links are
+// always in scope. If follow is not nil, links for which it is false are only
+// fetched if they are followed from elsewhere. The pages become the links of from.
+func (pm *pageMap) getPages(from *page, links []*url.URL, follow []bool) ([]Page, []Page) {
 	keys := make([]string, 0, len(links))
-	for _, l := range links {
-		if l.Host == pm.host {
-			keys = append(keys, l.RequestURI())
+	urls := make([]*url.URL, 0, len(links))
+	external := make([]bool, 0, len(links))
+	nofollow := make([]bool, 0, len(links))
+	for i, l := range links {
+		if !l.IsAbs() {
+			continue
+		}
+		nofollow = append(nofollow, follow != nil && !follow[i])
+		l = pm.normalize.Normalize(l)
+		if pm.inHost(l) {
+			l = pm.scope.strip(l)
+			// robots.txt of new hosts is fetched before taking the lock
+			pm.robots.get(l)
 		}
+		keys = append(keys, pageKey(l))
+		external = append(external, !pm.inHost(l))
+		urls = append(urls, l)
 	}
 
 	pages := make([]Page, len(keys))
 	newPages := make([]Page, 0)
+	var created []Page
+	defer func() { pm.discovered(created) }()
 
 	pm.lock.Lock()
 	defer pm.lock.Unlock()
+	depth := 0
+	if from != nil {
+		depth = from.depth + 1
+	}
 	for i, k := range keys {
-		page := pm.pages[k]
-		if page == nil {
-			page = newEagerPage(links[i])
-			pm.pages[k] = page
-			newPages = append(newPages, page)
+		p, _ := pm.pages[k].(*page)
+		if p == nil {
+			p = pm.newPage(urls[i])
+			p.depth = depth
+			if external[i] {
+				p.status = PageExternal
+			} else if from != nil && !pm.scope.Allowed(p.url) {
+				p.status = PageOutOfScope
+			} else if !pm.robots.allowed(p.url) {
+				p.status = PageBlocked
+			}
+			pm.pages[k] = p
+			created = append(created, p)
+		} else if depth < p.depth {
+			// a shorter path may bring a page skipped for depth within the limit
+			newPages = pm.lowerDepth(p, depth, newPages)
+		}
+		if !pm.lazy && !nofollow[i] && pm.enqueue(p) {
+			newPages = append(newPages, p)
 		}
-		pages[i] = page
+		pages[i] = p
+	}
+	if from != nil {
+		from.linked, from.nofollow = pages, nofollow
 	}
 	return pages, newPages
 }
 
+// lowerDepth lowers the depth of p, found by a shorter path, and that of the pages
+// it already links to in turn. The followed links brought within the depth limit
+// are enqueued and appended to newPages. Must be called with the lock held.
+func (pm *pageMap) lowerDepth(p *page, depth int, newPages []Page) []Page {
+	p.depth = depth
+	for i, lp := range p.linked {
+		lp := lp.(*page)
+		if depth+1 >= lp.depth {
+			continue
+		}
+		newPages = pm.lowerDepth(lp, depth+1, newPages)
+		if !pm.lazy && !p.nofollow[i] && pm.enqueue(lp) {
+			newPages = append(newPages, lp)
+		}
+	}
+	return newPages
+}
+
+// enqueue marks p as queued for fetching if it has not been already and it is
+// within the limits. Must be called with the lock held.
+func (pm *pageMap) enqueue(p *page) bool {
+	if p.queued || p.status == PageBlocked || p.status == PageOutOfScope || p.status == PageExternal {
+		return false
+	}
+	if pm.maxDepth > 0 && p.depth > pm.maxDepth {
+		return false
+	}
+	if pm.maxPages > 0 && pm.queued >= pm.maxPages {
+		return false
+	}
+	p.queued = true
+	pm.queued++
+	return true
+}
+
+// claim enqueues p for fetching, for pages that are fetched on demand.
+func (pm *pageMap) claim(p *page) bool {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+	return pm.enqueue(p)
+}
+
+// resolveRedirect makes the page that p redirected to the canonical page for the
+// fetched content, recording a target outside the hosts or scope as an external or
+// out of scope page. It returns the page that the fetched content belongs to, or nil
+// if the content should be discarded because the canonical page is fetched
+// separately, or would not be fetched for being outside the hosts, scope, robots.txt
+// or limits. Lazy canonical pages always fetch their own content when used.
+func (pm *pageMap) resolveRedirect(p *page) *page {
+	if len(p.redirects) == 0 || p.err == ErrRedirectLoop || p.err == ErrTooManyRedirects {
+		return p
+	}
+	final := pm.scope.strip(pm.normalize.Normalize(p.redirects[len(p.redirects)-1].URL))
+	key := pageKey(final)
+	if key == pageKey(p.url) {
+		// the redirect is to another form of the same URL
+		return p
+	}
+
+	if pm.inHost(final) {
+		// robots.txt of new hosts is fetched before taking the lock
+		pm.robots.get(final)
+	}
+
+	var created []Page
+	defer func() { pm.discovered(created) }()
+
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+	p.status = PageRedirect
+
+	t, _ := pm.pages[key].(*page)
+	if t == nil {
+		t = pm.newPage(final)
+		t.depth = p.depth
+		if !pm.inHost(final) {
+			t.status = PageExternal
+		} else if !pm.scope.Allowed(final) {
+			t.status = PageOutOfScope
+		} else if !pm.robots.allowed(final) {
+			t.status = PageBlocked
+		}
+		pm.pages[key] = t
+		created = append(created, t)
+	} else if p.depth < t.depth {
+		t.depth = p.depth
+	}
+	p.canonical = t
+	t.aliases = append(t.aliases, p.url)
+	// the target takes over the content only if it would have been fetched itself,
+	// so that the redirect does not get around robots.txt or the limits
+	if pm.lazy || !pm.enqueue(t) {
+		p.assets, p.err = nil, nil
+		return nil
+	}
+	t.status = PageFetched
+	t.assets, t.err = p.assets, p.err
+	p.assets, p.err = nil, nil
+	return t
+}
+
+// NewCrawler creates a crawler that makes at most maxRequests simultaneous fetches
+// with fetcher. HTTPFetcher is used if fetcher is nil.
 func NewCrawler(maxRequests int, fetcher Fetcher) *Crawler {
 	if fetcher == nil {
-		fetcher = FetchPageHTTP
+		fetcher = HTTPFetcher
 	}
 	if maxRequests == 0 {
 		maxRequests = defaultMaxRequests
@@ -128,51 +547,323 @@ func NewCrawler(maxRequests int, fetcher Fetcher) *Crawler {
 }
 
 type crawlerState struct {
+	ctx            context.Context
 	fetchSemaphore chan sentinel
 	wg             sync.WaitGroup
 	fetcher        Fetcher
+	retry          RetryPolicy
+	limiters       *hostLimiters
+	robotsMeta     bool
+	meta           MetaField
 	pageMap        *pageMap
 }
 
+// ErrNoSeeds is returned when a crawl is started without any seed URLs.
+var ErrNoSeeds = errors.New("no seed URLs")
+
 // Crawl synchronously crawls the rootURL for links within the same host
 // using the fetcher.
 func (c *Crawler) Crawl(rootURL string) (*Result, error) {
-	u, err := url.Parse(rootURL)
-	if err != nil {
-		return nil, err
+	return c.CrawlContext(context.Background(), rootURL)
+}
+
+// CrawlContext is like Crawl, but stops when ctx is done. No new pages are scheduled
+// after that point and in-flight fetches are aborted. The partial result is returned
+// along with the context error; pages that were never fetched have status PageUnfetched
+// and aborted fetches have status PageCancelled. A lazy crawl returns immediately,
+// and ctx then bounds the fetches made while walking the result.
+func (c *Crawler) CrawlContext(ctx context.Context, rootURL string) (*Result, error) {
+	return c.CrawlSeeds(ctx, []string{rootURL})
+}
+
+// CrawlSeeds is like CrawlContext, but crawls from each of seedURLs at depth zero,
+// so that sections not linked from the first seed are crawled too. The seeds
+// share the pages and the request limit of the crawl, and the hosts of all of
+// them are crawled. The first seed is the root of the result.
+func (c *Crawler) CrawlSeeds(ctx context.Context, seedURLs []string) (*Result, error) {
+	if len(seedURLs) == 0 {
+		return nil, ErrNoSeeds
+	}
+	seeds := make([]*url.URL, len(seedURLs))
+	for i, s := range seedURLs {
+		u, err := url.Parse(s)
+		if err != nil {
+			return nil, err
+		}
+		if !u.IsAbs() {
+			return nil, fmt.Errorf("seed URL is not absolute: %v", s)
+		}
+		seeds[i] = u
 	}
+	u := seeds[0]
 
 	cs := &crawlerState{
+		ctx:            ctx,
 		fetchSemaphore: make(chan sentinel, c.maxRequests),
 		pageMap:        newPageMap(u.Host),
 		fetcher:        c.fetcher,
+		retry:          c.Retry,
+		robotsMeta:     c.RespectRobotsMeta,
+		meta:           c.Metadata,
+	}
+	cs.pageMap.maxDepth = c.MaxDepth
+	cs.pageMap.maxPages = c.MaxPages
+	cs.pageMap.observer = c.Observer
+	cs.pageMap.scope = c.Scope
+	if c.Normalizer != nil {
+		cs.pageMap.normalize = c.Normalizer
+	}
+	var matchers []func(u *url.URL) bool
+	for i := range seeds {
+		seeds[i] = cs.pageMap.normalize.Normalize(seeds[i])
+		matchers = append(matchers, c.Scope.hostMatcher(seeds[i]))
+	}
+	u = seeds[0]
+	cs.pageMap.inHost = matchers[0]
+	if len(matchers) > 1 {
+		cs.pageMap.inHost = func(u *url.URL) bool {
+			for _, m := range matchers {
+				if m(u) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	agent := c.UserAgent
+	if agent == "" {
+		agent = DefaultUserAgent
+	}
+	// robots.txt, sitemaps and the checks after the crawl are fetched like the
+	// pages if possible
+	hf, ok := c.fetcher.(*httpFetcher)
+	if !ok {
+		hf = defaultHTTPFetcher
 	}
+	if c.RespectRobots {
+		cs.pageMap.robots = newRobotsCache(ctx, hf, agent)
+	}
+	cs.limiters = newHostLimiters(c.RateLimit, cs.pageMap.robots)
 
-	rootPage := newEagerPage(u)
-	cs.pageMap.pages[u.RequestURI()] = rootPage
-	cs.fetchPage(rootPage)
+	if c.Lazy {
+		cs.pageMap.lazy = true
+		cs.pageMap.newPage = func(u *url.URL) *page {
+			return newLazyPage(u, cs)
+		}
+	}
+
+	seedPages, fetch := cs.pageMap.getPages(nil, seeds, nil)
+	var roots []Page
+	seen := map[Page]bool{}
+	for _, p := range seedPages {
+		if !seen[p] {
+			seen[p] = true
+			roots = append(roots, p)
+		}
+	}
+	if c.Lazy {
+		return &Result{
+			roots:  roots,
+			robots: cs.pageMap.robots.get(u),
+			pages:  cs.pageMap.pages,
+		}, nil
+	}
+	n := c.CheckRequests
+	if n == 0 {
+		n = c.maxRequests
+	}
+	var sitemap *SitemapReport
+	var listed []*url.URL
+	if c.UseSitemaps || len(c.SitemapURLs) > 0 {
+		listed, sitemap = cs.readSitemaps(hf, n, cs.seedSitemapURLs(hf, agent, roots, c.SitemapURLs, c.UseSitemaps))
+		_, more := cs.pageMap.getPages(nil, listed, nil)
+		fetch = append(fetch, more...)
+	}
+	for _, p := range fetch {
+		cs.fetchPage(p)
+	}
 
 	cs.wg.Wait()
+	sitemap.finish(cs.pageMap, roots, listed)
+	if c.CheckExternal || c.VerifyAssets || c.CrawlStylesheets {
+		checker := hf
+		// stylesheets come first for their assets to be verified too
+		if c.CrawlStylesheets {
+			cs.crawlStylesheets(checker, n)
+		}
+		if c.CheckExternal {
+			cs.checkLinks(checker, n)
+		}
+		if c.VerifyAssets {
+			cs.verifyAssets(checker, n)
+		}
+	}
+	cs.emit(Event{Type: EventCrawlFinished, Err: ctx.Err()})
 	return &Result{
-		root:  rootPage,
-		pages: cs.pageMap.pages,
-	}, nil
+		roots:   roots,
+		robots:  cs.pageMap.robots.get(u),
+		sitemap: sitemap,
+		pages:   cs.pageMap.pages,
+	}, ctx.Err()
 }
 
-func (cs *crawlerState) fetchPage(p Page) {
-	cs.wg.Add(1)
-	cs.fetchSemaphore <- sentinel{}
-	go func() {
-		links := cs.fetcher(p)
+func (cs *crawlerState) emit(e Event) {
+	if cs.pageMap.observer != nil {
+		cs.pageMap.observer.Observe(e)
+	}
+}
+
+// acquire waits for a request slot. It returns false without a slot if the crawl
+// is cancelled first.
+func (cs *crawlerState) acquire() bool {
+	select {
+	case cs.fetchSemaphore <- sentinel{}:
+	case <-cs.ctx.Done():
+		return false
+	}
+	// both cases may have been ready
+	if cs.ctx.Err() != nil {
+		<-cs.fetchSemaphore
+		return false
+	}
+	return true
+}
 
+// fetch fetches p while holding a request slot, which is released once the fetcher
+// returns. The slot is held while waiting for the rate limit. Failed fetches are
+// retried according to the retry policy, without holding a slot while waiting.
+// The linked pages that should be fetched next are returned.
+func (cs *crawlerState) fetch(p *page) []Page {
+	cs.emit(Event{Type: EventFetchStarted, Page: p})
+	var res *FetchResult
+	for {
+		if !cs.wait(p.url) {
+			<-cs.fetchSemaphore
+			res = &FetchResult{URL: p.url, Err: cs.ctx.Err()}
+			break
+		}
+		cs.pageMap.lock.Lock()
+		p.attempts++
+		attempts := p.attempts
+		cs.pageMap.lock.Unlock()
+		res = cs.fetcher.Fetch(cs.ctx, p.url)
 		<-cs.fetchSemaphore
+		cs.limiters.get(p.url).observe(res)
 
-		if len(links) >= 1 {
-			linked, unfetched := cs.pageMap.getPages(links)
-			p.(*page).linked = linked
-			for _, np := range unfetched {
-				cs.fetchPage(np)
-			}
+		delay, retry := cs.retry.delay(attempts, res)
+		if !retry || !cs.sleep(delay) || !cs.acquire() {
+			break
+		}
+	}
+	links := res.fill(p)
+
+	fp := p
+	err := fp.err
+	// the status of lazy pages may be read while they are fetched
+	cs.pageMap.lock.Lock()
+	cancelled := err != nil && cs.ctx.Err() != nil
+	if cancelled {
+		fp.status = PageCancelled
+	} else {
+		fp.status = PageFetched
+	}
+	attempts := p.attempts
+	cs.pageMap.lock.Unlock()
+	if !cancelled {
+		fp = cs.pageMap.resolveRedirect(fp)
+	}
+	cs.emit(Event{Type: EventFetchFinished, Page: p, StatusCode: res.StatusCode, Attempts: attempts, Err: err})
+
+	if fp == nil {
+		return nil
+	}
+	fp.noIndex = cs.robotsMeta && res.NoIndex
+	fp.meta = res.Meta.only(cs.meta)
+	if len(res.Anchors) > 0 {
+		fp.anchors = make(map[string]bool, len(res.Anchors))
+		for _, a := range res.Anchors {
+			fp.anchors[a] = true
+		}
+	}
+	if len(links) == 0 {
+		return nil
+	}
+	links, infos := absLinks(links, res.LinkInfo)
+	for i, l := range links {
+		infos[i].Fragment = l.Fragment
+	}
+	var follow []bool
+	if cs.robotsMeta {
+		follow = make([]bool, len(links))
+		for i := range links {
+			follow[i] = !res.NoFollow && !infos[i].HasRel("nofollow")
+		}
+	}
+	_, fetch := cs.pageMap.getPages(fp, links, follow)
+	fp.linkInfo = infos
+	return fetch
+}
+
+// absLinks returns the absolute links and their infos, with the infos padded to
+// the same length.
+func absLinks(links []*url.URL, infos []LinkInfo) ([]*url.URL, []LinkInfo) {
+	abs := make([]*url.URL, 0, len(links))
+	absInfos := make([]LinkInfo, 0, len(links))
+	for i, l := range links {
+		if !l.IsAbs() {
+			continue
+		}
+		abs = append(abs, l)
+		if i < len(infos) {
+			absInfos = append(absInfos, infos[i])
+		} else {
+			absInfos = append(absInfos, LinkInfo{})
+		}
+	}
+	return abs, absInfos
+}
+
+// wait waits until the rate limit allows another request to the host of u,
+// returning false if the crawl is cancelled first.
+func (cs *crawlerState) wait(u *url.URL) bool {
+	l := cs.limiters.get(u)
+	if l == nil {
+		return true
+	}
+	// other requests may be taken while sleeping, so it is tried again
+	for {
+		d := l.take(time.Now())
+		if d <= 0 {
+			return true
+		}
+		if !cs.sleep(d) {
+			return false
+		}
+	}
+}
+
+// sleep waits for d, returning false if the crawl is cancelled first.
+func (cs *crawlerState) sleep(d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-cs.ctx.Done():
+		return false
+	}
+}
+
+// fetchPage schedules a fetch of p once a request slot is available. If the crawl
+// is cancelled first, p is left unfetched.
+func (cs *crawlerState) fetchPage(p Page) {
+	if !cs.acquire() {
+		return
+	}
+	cs.wg.Add(1)
+	go func() {
+		for _, np := range cs.fetch(p.(*page)) {
+			cs.fetchPage(np)
 		}
 		cs.wg.Done()
 	}()
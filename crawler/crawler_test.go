@@ -1,9 +1,13 @@
 package crawler
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"runtime"
+	"sync"
 	"sync/atomic"
 	"testing"
 
@@ -39,7 +43,7 @@ func TestPageMapGetPages(t *testing.T) {
 	})
 
 	pm := newPageMap("testhost.local")
-	pages, newPages := pm.getPages(links)
+	pages, newPages := pm.getPages(nil, links, nil)
 
 	// per spec, URLs must be absolute
 	if assert.Equal(t, 2, len(pages), "all same host pages should be returned") {
@@ -50,7 +54,7 @@ func TestPageMapGetPages(t *testing.T) {
 	links = mapURLs(nil, []string{
 		"http://testhost.local/page1.html",
 	})
-	pages, newPages = pm.getPages(links)
+	pages, newPages = pm.getPages(nil, links, nil)
 
 	if assert.Equal(t, 1, len(pages), "all requested pages should be returned") {
 		assert.Equal(t, *links[0], *pages[0].URL(), "URL should be preserved")
@@ -60,12 +64,41 @@ func TestPageMapGetPages(t *testing.T) {
 	links = mapURLs(nil, []string{
 		"http://testhost.local/page2.html?query3",
 	})
-	pages, newPages = pm.getPages(links)
+	pages, newPages = pm.getPages(nil, links, nil)
 
 	assert.Equal(t, 1, len(pages), "all requested pages should be returned")
 	assert.Equal(t, 0, len(newPages), "pages with same HTTP request URI are not returned new")
 }
 
+func TestPageMapLimits(t *testing.T) {
+	pm := newPageMap("testhost.local")
+	pm.maxDepth = 1
+	pm.maxPages = 3
+
+	roots, fetch := pm.getPages(nil, mapURLs(nil, []string{"http://testhost.local/"}), nil)
+	assert.Equal(t, 1, len(fetch), "the root is fetched")
+	root := roots[0].(*page)
+
+	links := mapURLs(nil, []string{
+		"http://testhost.local/page1.html",
+		"http://testhost.local/page2.html",
+		"http://testhost.local/page3.html",
+	})
+	pages, fetch := pm.getPages(root, links, nil)
+	assert.Equal(t, 3, len(pages), "all pages are returned")
+	assert.Equal(t, 2, len(fetch), "only pages within the page limit are fetched")
+	assert.Equal(t, 1, pages[2].Depth())
+
+	pages, fetch = pm.getPages(pages[0].(*page), mapURLs(nil, []string{"http://testhost.local/page4.html"}), nil)
+	assert.Equal(t, 0, len(fetch), "pages beyond the depth limit are not fetched")
+	assert.Equal(t, 2, pages[0].Depth())
+
+	pm.maxPages = 0
+	pages, fetch = pm.getPages(root, mapURLs(nil, []string{"http://testhost.local/page4.html"}), nil)
+	assert.Equal(t, 1, len(fetch), "a page found on a shorter path is fetched")
+	assert.Equal(t, 1, pages[0].Depth())
+}
+
 var pages = map[string][]string{
 	"/":            {"/page1.html", "/page2.html", "/page3.html"},
 	"/page1.html":  {"/page2.html", "/page3.html"},
@@ -84,6 +117,48 @@ var pages = map[string][]string{
 	"/page14.html": {},
 }
 
+func TestCrawlerDepthShorterPathLater(t *testing.T) {
+	depthPages := map[string][]string{
+		"/":  {"/a", "/c"},
+		"/a": {"/x"},
+		"/c": {"/d"},
+		"/d": {"/x"},
+		"/x": {"/y"},
+		"/y": {"/z"},
+		"/z": {},
+	}
+	// /a, on the shorter path to /x, is only done once the longer path has been
+	// followed from /x
+	found := make(chan struct{})
+	observer := ObserverFunc(func(e Event) {
+		if e.Type == EventDiscovered && e.Page.URL().Path == "/y" {
+			close(found)
+		}
+	})
+	var numFetches uint32
+	fetcher := func(p Page) []*url.URL {
+		atomic.AddUint32(&numFetches, 1)
+		if p.URL().Path == "/a" {
+			<-found
+		}
+		return mapURLs(p.URL(), depthPages[p.URL().Path])
+	}
+
+	c := NewCrawler(2, PageFetcherFunc(fetcher))
+	c.MaxDepth = 3
+	c.Observer = observer
+	cr, err := c.Crawl("http://testhost.local/")
+	assert.NoError(t, err)
+
+	lt := cr.LookupTable()
+	assert.Equal(t, 2, lt["http://testhost.local/x"].Depth)
+	assert.Equal(t, 3, lt["http://testhost.local/y"].Depth, "the shorter path is passed on to linked pages")
+	assert.Equal(t, "", lt["http://testhost.local/y"].Status, "pages brought within the depth limit are fetched")
+	assert.Equal(t, 4, lt["http://testhost.local/z"].Depth)
+	assert.Equal(t, PageUnfetched.String(), lt["http://testhost.local/z"].Status)
+	assert.Equal(t, uint32(6), numFetches)
+}
+
 func TestCrawlerErrors(t *testing.T) {
 	var numFetches uint32
 
@@ -92,7 +167,7 @@ func TestCrawlerErrors(t *testing.T) {
 		return nil
 	}
 
-	c := NewCrawler(0, fetcher)
+	c := NewCrawler(0, PageFetcherFunc(fetcher))
 	_, err := c.Crawl("%gh&%ij")
 
 	assert.Error(t, err, "error is returned for malformed root URL")
@@ -116,7 +191,7 @@ func TestCrawler(t *testing.T) {
 	for _, nc := range []int{0, 1, 2, 50000} {
 		atomic.StoreUint32(&numFetches, 0)
 
-		c := NewCrawler(nc, fetcher)
+		c := NewCrawler(nc, PageFetcherFunc(fetcher))
 		cr, err := c.Crawl(baseURL.String())
 
 		assert.NoError(t, err)
@@ -166,9 +241,391 @@ func TestCrawlerConcurrency(t *testing.T) {
 		return mapURLs(p.URL(), links)
 	}
 
-	c := NewCrawler(6, fetcher)
+	c := NewCrawler(6, PageFetcherFunc(fetcher))
 	c.Crawl(baseURL.String())
 
 	assert.Equal(t, len(pages), numFetches, "all pages were fetched")
 	assert.Equal(t, 6, maxConcurrent, "request concurrency is within limits")
 }
+
+func TestCrawlerSeeds(t *testing.T) {
+	seedPages := map[string][]string{
+		"http://testhost.local/":                {"/page1.html"},
+		"http://testhost.local/page1.html":      {},
+		"http://testhost.local/landing.html":    {"/landing2.html"},
+		"http://testhost.local/landing2.html":   {"/page1.html"},
+		"http://other.testhost.local/":          {"/docs.html", "http://testhost.local/"},
+		"http://other.testhost.local/docs.html": {},
+	}
+	var numFetches uint32
+	fetcher := func(p Page) []*url.URL {
+		atomic.AddUint32(&numFetches, 1)
+		links, ok := seedPages[p.URL().String()]
+		if !ok {
+			t.Errorf("test requesting nonexistant URL: %v", p.URL())
+		}
+		return mapURLs(p.URL(), links)
+	}
+
+	c := NewCrawler(2, PageFetcherFunc(fetcher))
+	cr, err := c.CrawlSeeds(context.Background(), []string{
+		"http://testhost.local/",
+		"http://testhost.local/landing.html",
+		"http://other.testhost.local",
+		"http://testhost.local/",
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, uint32(len(seedPages)), numFetches, "the pages of every seed are fetched once")
+	assert.Equal(t, "http://testhost.local/", cr.Root().URL().String(), "the first seed is the root")
+	var roots []string
+	for _, p := range cr.Roots() {
+		roots = append(roots, p.URL().String())
+		assert.Equal(t, 0, p.Depth(), "seeds are at depth zero")
+	}
+	assert.Equal(t, []string{"http://testhost.local/", "http://testhost.local/landing.html", "http://other.testhost.local/"},
+		roots, "duplicate seeds are dropped")
+	lt := cr.LookupTable()
+	assert.Equal(t, 1, lt["http://testhost.local/landing2.html"].Depth)
+	assert.Equal(t, "", lt["http://other.testhost.local/docs.html"].Status, "the hosts of all seeds are crawled")
+
+	_, err = c.CrawlSeeds(context.Background(), nil)
+	assert.Equal(t, ErrNoSeeds, err)
+	_, err = c.CrawlSeeds(context.Background(), []string{"http://testhost.local/", "/relative"})
+	assert.Error(t, err, "seeds must be absolute")
+}
+
+func TestCrawlContextCancel(t *testing.T) {
+	baseURL, _ := url.Parse("http://testhost.local/")
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var numFetches uint32
+	fetcher := FetcherFunc(func(ctx context.Context, u *url.URL) *FetchResult {
+		if atomic.AddUint32(&numFetches, 1) == 3 {
+			cancel()
+			<-ctx.Done()
+			return &FetchResult{URL: u, Err: ctx.Err()}
+		}
+		return &FetchResult{URL: u, Links: mapURLs(u, pages[u.RequestURI()])}
+	})
+
+	c := NewCrawler(1, fetcher)
+	cr, err := c.CrawlContext(ctx, baseURL.String())
+
+	assert.Equal(t, context.Canceled, err, "the context error is returned")
+	if !assert.NotNil(t, cr, "a partial result is returned") {
+		return
+	}
+	assert.Equal(t, uint32(3), numFetches, "no fetches are scheduled after cancellation")
+	assert.Equal(t, PageFetched, cr.Root().Status())
+
+	statuses := map[string]int{}
+	for _, pr := range cr.LookupTable() {
+		statuses[pr.Status]++
+	}
+	assert.Equal(t, 2, statuses[""], "fetched pages have no status in the lookup table")
+	assert.Equal(t, 1, statuses[PageCancelled.String()], "the aborted fetch is marked cancelled")
+	assert.Equal(t, 1, statuses[PageUnfetched.String()], "remaining pages are marked unfetched")
+}
+
+func TestCrawlerLimits(t *testing.T) {
+	baseURL, _ := url.Parse("http://testhost.local/")
+
+	var numFetches uint32
+	fetcher := func(p Page) []*url.URL {
+		atomic.AddUint32(&numFetches, 1)
+		return mapURLs(p.URL(), pages[p.URL().RequestURI()])
+	}
+
+	c := NewCrawler(1, PageFetcherFunc(fetcher))
+	c.MaxDepth = 2
+	cr, _ := c.Crawl(baseURL.String())
+
+	assert.Equal(t, uint32(5), numFetches, "pages up to depth 2 are fetched")
+	lt := cr.LookupTable()
+	assert.Equal(t, 6, len(lt), "pages beyond the depth limit are recorded")
+	assert.Equal(t, PageUnfetched.String(), lt["http://testhost.local/page5.html"].Status)
+	assert.Equal(t, 3, lt["http://testhost.local/page5.html"].Depth)
+
+	atomic.StoreUint32(&numFetches, 0)
+	c = NewCrawler(3, PageFetcherFunc(fetcher))
+	c.MaxPages = 4
+	cr, _ = c.Crawl(baseURL.String())
+
+	assert.Equal(t, uint32(4), numFetches, "the page limit is respected")
+	unfetched := 0
+	for _, pr := range cr.LookupTable() {
+		if pr.Status == PageUnfetched.String() {
+			unfetched++
+		}
+	}
+	assert.Equal(t, len(cr.LookupTable())-4, unfetched, "pages beyond the page limit are recorded")
+}
+
+func TestCrawlerRedirects(t *testing.T) {
+	baseURL, _ := url.Parse("http://testhost.local/")
+	redirects := map[string]string{
+		"/old.html":   "/page1.html",
+		"/moved.html": "/new.html",
+		"/away.html":  "http://otherhost.local/",
+		"/gone.html":  "/private/page.html",
+	}
+	site := map[string][]string{
+		"/":           {"/old.html", "/moved.html", "/away.html", "/gone.html", "/page1.html"},
+		"/page1.html": {},
+		"/new.html":   {"/page2.html"},
+		"/page2.html": {},
+	}
+
+	fetcher := func(p Page) []*url.URL {
+		u := p.URL()
+		if to, ok := redirects[u.RequestURI()]; ok {
+			u, _ = u.Parse(to)
+			p.SetRedirects([]Redirect{{301, u}})
+		}
+		return mapURLs(u, site[u.RequestURI()])
+	}
+
+	c := NewCrawler(1, PageFetcherFunc(fetcher))
+	c.Scope = &Scope{Exclude: []ScopeRule{PathPrefix("/private/")}}
+	cr, err := c.Crawl(baseURL.String())
+	assert.NoError(t, err)
+
+	lt := cr.LookupTable()
+	assert.Equal(t, 10, len(lt))
+
+	old := lt["http://testhost.local/old.html"]
+	assert.Equal(t, PageRedirect.String(), old.Status)
+	assert.Equal(t, []RedirectRecord{{301, "http://testhost.local/page1.html"}}, old.Redirects)
+	assert.Equal(t, []string{"http://testhost.local/old.html"}, lt["http://testhost.local/page1.html"].Aliases,
+		"the redirect target is deduplicated")
+
+	assert.Equal(t, PageRedirect.String(), lt["http://testhost.local/moved.html"].Status)
+	assert.Equal(t, []string{"http://testhost.local/page2.html"}, lt["http://testhost.local/new.html"].Links,
+		"a new redirect target takes over the fetched content")
+
+	away := lt["http://testhost.local/away.html"]
+	assert.Equal(t, PageRedirect.String(), away.Status)
+	assert.Empty(t, away.Links)
+	assert.Equal(t, PageExternal.String(), lt["http://otherhost.local/"].Status, "an off-host target is recorded as external")
+	assert.Equal(t, []string{"http://testhost.local/away.html"}, lt["http://otherhost.local/"].Aliases)
+	assert.Equal(t, PageOutOfScope.String(), lt["http://testhost.local/private/page.html"].Status,
+		"an out of scope target is recorded as such")
+
+	for _, p := range cr.Root().Links() {
+		switch p.URL().Path {
+		case "/old.html":
+			assert.Equal(t, "/page1.html", p.Canonical().URL().Path)
+		case "/away.html":
+			assert.Equal(t, "http://otherhost.local/", p.Canonical().URL().String())
+		}
+	}
+}
+
+func TestCrawlerRedirectLimits(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+		case "/":
+			w.Write([]byte(`<html><body><a href="/go">go</a><a href="/moved">moved</a></body></html>`))
+		case "/go":
+			http.Redirect(w, r, "/private/x", http.StatusMovedPermanently)
+		case "/moved":
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+		case "/private/x":
+			w.Write([]byte(`<html><body><a href="/secret">secret</a></body></html>`))
+		}
+	}))
+	defer ts.Close()
+
+	c := NewCrawler(1, nil)
+	c.RespectRobots = true
+	cr, err := c.Crawl(ts.URL + "/")
+	assert.NoError(t, err)
+
+	lt := cr.LookupTable()
+	assert.Equal(t, PageRedirect.String(), lt[ts.URL+"/go"].Status)
+	assert.Equal(t, PageBlocked.String(), lt[ts.URL+"/private/x"].Status, "a disallowed target does not take over the content")
+	assert.Empty(t, lt[ts.URL+"/private/x"].Links)
+	assert.NotContains(t, lt, ts.URL+"/secret", "the links of a disallowed target are not followed")
+	assert.Equal(t, "", lt[ts.URL+"/new"].Status)
+
+	// the root and both redirects leave room for one of the targets
+	c = NewCrawler(1, nil)
+	c.MaxPages = 4
+	cr, err = c.Crawl(ts.URL + "/")
+	assert.NoError(t, err)
+
+	lt = cr.LookupTable()
+	statuses := map[string]int{}
+	for _, target := range []string{"/private/x", "/new"} {
+		statuses[lt[ts.URL+target].Status]++
+	}
+	assert.Equal(t, map[string]int{"": 1, PageUnfetched.String(): 1}, statuses,
+		"taking over the content counts toward the page limit")
+}
+
+func TestCrawlerEvents(t *testing.T) {
+	baseURL, _ := url.Parse("http://testhost.local/")
+
+	var lock sync.Mutex
+	events := map[EventType]int{}
+	var last EventType
+	observer := ObserverFunc(func(e Event) {
+		lock.Lock()
+		defer lock.Unlock()
+		events[e.Type]++
+		last = e.Type
+	})
+
+	fetcher := func(p Page) []*url.URL {
+		return mapURLs(p.URL(), pages[p.URL().RequestURI()])
+	}
+
+	c := NewCrawler(3, PageFetcherFunc(fetcher))
+	c.Observer = observer
+	c.Crawl(baseURL.String())
+
+	assert.Equal(t, len(pages), events[EventDiscovered], "every page is discovered once")
+	assert.Equal(t, len(pages), events[EventFetchStarted], "every fetch start is sent")
+	assert.Equal(t, len(pages), events[EventFetchFinished], "every fetch finish is sent")
+	assert.Equal(t, 1, events[EventCrawlFinished])
+	assert.Equal(t, EventCrawlFinished, last, "the crawl finished event is last")
+}
+
+func TestCrawlerEventStatus(t *testing.T) {
+	var lock sync.Mutex
+	finished := map[string]Event{}
+	observer := ObserverFunc(func(e Event) {
+		if e.Type == EventFetchFinished {
+			lock.Lock()
+			finished[e.Page.URL().Path] = e
+			lock.Unlock()
+		}
+	})
+	fetcher := FetcherFunc(func(ctx context.Context, u *url.URL) *FetchResult {
+		if u.Path == "/missing.html" {
+			return &FetchResult{URL: u, StatusCode: 404, Err: fmt.Errorf("non 200 status code received: 404")}
+		}
+		return &FetchResult{URL: u, StatusCode: 200, Links: mapURLs(u, []string{"/missing.html"})}
+	})
+
+	c := NewCrawler(1, fetcher)
+	c.Observer = observer
+	c.Crawl("http://testhost.local/")
+
+	assert.Equal(t, 200, finished["/"].StatusCode)
+	assert.Equal(t, 1, finished["/"].Attempts)
+	assert.NoError(t, finished["/"].Err)
+	assert.Equal(t, 404, finished["/missing.html"].StatusCode, "the status code comes with the error")
+	assert.Error(t, finished["/missing.html"].Err)
+}
+
+func TestCrawlerFetcherFunc(t *testing.T) {
+	fetcher := FetcherFunc(func(ctx context.Context, u *url.URL) *FetchResult {
+		return &FetchResult{
+			URL:        u,
+			StatusCode: 200,
+			Links:      mapURLs(u, pages[u.RequestURI()]),
+			Assets:     []Asset{{URL: mapURLs(u, []string{"/style.css"})[0]}},
+		}
+	})
+
+	c := NewCrawler(2, fetcher)
+	cr, err := c.Crawl("http://testhost.local/")
+	assert.NoError(t, err)
+	lt := cr.LookupTable()
+	assert.Equal(t, len(pages), len(lt))
+	assert.Equal(t, []string{"http://testhost.local/style.css"}, lt["http://testhost.local/"].Assets)
+}
+
+func TestCrawlerRobotsMeta(t *testing.T) {
+	var lock sync.Mutex
+	var fetched []string
+	fetcher := FetcherFunc(func(ctx context.Context, u *url.URL) *FetchResult {
+		lock.Lock()
+		fetched = append(fetched, u.Path)
+		lock.Unlock()
+		r := &FetchResult{URL: u, StatusCode: 200}
+		switch u.Path {
+		case "/":
+			r.Links = mapURLs(u, []string{"/ad.html", "/closed.html", "/hidden.html"})
+			r.LinkInfo = []LinkInfo{{Rel: []string{"sponsored", "nofollow"}}}
+		case "/closed.html":
+			r.Links = mapURLs(u, []string{"/behind.html"})
+			r.NoFollow = true
+		case "/hidden.html":
+			r.NoIndex = true
+		}
+		return r
+	})
+
+	c := NewCrawler(1, fetcher)
+	cr, err := c.Crawl("http://testhost.local/")
+	assert.NoError(t, err)
+	assert.Equal(t, 5, len(fetched), "robots meta tags are ignored by default")
+	assert.False(t, cr.LookupTable()["http://testhost.local/hidden.html"].NoIndex)
+
+	fetched = nil
+	c.RespectRobotsMeta = true
+	cr, err = c.Crawl("http://testhost.local/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/", "/closed.html", "/hidden.html"}, fetched)
+
+	edges := cr.Root().Edges()
+	if assert.Equal(t, 3, len(edges)) {
+		assert.Equal(t, "http://testhost.local/ad.html", edges[0].Page.URL().String())
+		assert.Equal(t, []string{"sponsored", "nofollow"}, edges[0].Rel)
+		assert.Equal(t, PageUnfetched, edges[0].Page.Status())
+		assert.Nil(t, edges[1].Rel)
+	}
+	lt := cr.LookupTable()
+	assert.Equal(t, []EdgeRecord{{URL: "http://testhost.local/ad.html", Rel: []string{"sponsored", "nofollow"}}}, lt["http://testhost.local/"].Edges)
+	assert.True(t, lt["http://testhost.local/hidden.html"].NoIndex)
+	assert.Equal(t, PageUnfetched.String(), lt["http://testhost.local/behind.html"].Status)
+}
+
+func TestCrawlerBrokenAnchors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<html><body id="main">
+<a href="/guide.html#install">Install</a>
+<a href="/guide.html#missing">Missing</a>
+<a href="/guide.html">Guide</a>
+<a href="#main">Main</a><a href="#top">Top</a><a href="#nowhere">Nowhere</a>
+<a href="/old#legacy">Old</a>
+<a href="/gone#install">Gone</a>
+</body></html>`))
+		case "/guide.html":
+			w.Write([]byte(`<html><body><h2 id="install">Install</h2><a name="legacy"></a></body></html>`))
+		case "/old":
+			http.Redirect(w, r, "/guide.html", 301)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	cr, err := NewCrawler(2, nil).Crawl(ts.URL + "/")
+	assert.NoError(t, err)
+	var broken []string
+	for _, e := range cr.Root().Edges() {
+		if e.BrokenAnchor() {
+			broken = append(broken, e.Page.URL().Path+"#"+e.Fragment)
+		}
+	}
+	assert.Equal(t, []string{"/guide.html#missing", "/#nowhere"}, broken)
+
+	edges := cr.Root().Edges()
+	assert.Equal(t, "install", edges[0].Fragment)
+	assert.Equal(t, ts.URL+"/guide.html", edges[0].Page.URL().String(), "the page has no fragment")
+	assert.Equal(t, "", edges[2].Fragment)
+	assert.True(t, edges[0].Page.HasAnchor("legacy"))
+
+	pr := cr.LookupTable()[ts.URL+"/"]
+	assert.Equal(t, []string{ts.URL + "/guide.html#missing", ts.URL + "/#nowhere"}, pr.BrokenAnchors)
+	assert.Equal(t, "install", pr.Edges[0].Fragment)
+}
@@ -0,0 +1,161 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/url"
+	"regexp"
+	"sync"
+)
+
+var (
+	// cssImportPattern matches the URL of an @import rule, given as a string or with url().
+	cssImportPattern = regexp.MustCompile(`@import\s+(?:url\(\s*)?(?:'([^']*)'|"([^"]*)"|([^'")\s;]+))`)
+	// cssCommentPattern matches CSS comments, which may hold commented out rules.
+	cssCommentPattern = regexp.MustCompile(`(?s)/\*.*?\*/`)
+)
+
+// cssRefs calls add with each @import and url() reference of a stylesheet, and
+// the kind of asset it is. Imports are stylesheets, and other references are
+// taken to be images unless they are fonts by their file extension.
+func cssRefs(css string, add func(ref string, kind AssetKind)) {
+	css = cssCommentPattern.ReplaceAllString(css, "")
+	imports := map[string]bool{}
+	for _, m := range cssImportPattern.FindAllStringSubmatch(css, -1) {
+		if ref := m[1] + m[2] + m[3]; ref != "" {
+			imports[ref] = true
+			add(ref, AssetStylesheet)
+		}
+	}
+	for _, ref := range cssURLs(css) {
+		if !imports[ref] {
+			add(ref, kindByPath(ref, AssetImage))
+		}
+	}
+}
+
+// fetchCSS fetches the stylesheet at u and returns the resources it references,
+// resolved relative to its final URL, and the status code of the final response.
+func (f *httpFetcher) fetchCSS(ctx context.Context, u *url.URL) ([]Asset, int, error) {
+	ctx, cancel := f.withTimeout(ctx)
+	defer cancel()
+	res, _, err := f.get(ctx, u)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return nil, res.StatusCode, fmt.Errorf("non 200 status code received: %v", res.StatusCode)
+	}
+	// an error page in place of the stylesheet has nothing to add
+	if mt, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type")); mt == "text/html" {
+		return nil, res.StatusCode, fmt.Errorf("not a stylesheet: %v", mt)
+	}
+	var body io.Reader = res.Body
+	if f.opts.MaxBodySize > 0 {
+		body = io.LimitReader(body, f.opts.MaxBodySize)
+	}
+	css, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, res.StatusCode, err
+	}
+
+	var assets []Asset
+	seen := map[string]bool{}
+	cssRefs(string(css), func(ref string, kind AssetKind) {
+		if au := resolveRef(res.Request.URL, ref); au != nil && !seen[au.String()] {
+			seen[au.String()] = true
+			assets = append(assets, Asset{URL: au, Kind: kind})
+		}
+	})
+	return assets, res.StatusCode, nil
+}
+
+// crawlStylesheets fetches each unique stylesheet on the crawled hosts that the
+// fetched pages use, and the stylesheets they import, making at most maxRequests
+// simultaneous requests with fetcher. The references of each stylesheet become
+// its assets, and are added to the assets of the pages that use it. A stylesheet
+// that could not be fetched gets the status code and error of the attempt.
+func (cs *crawlerState) crawlStylesheets(fetcher *httpFetcher, maxRequests int) {
+	pm := cs.pageMap
+	sheets := map[string][]Asset{}
+	failed := map[string]*checkResult{}
+	var next []*url.URL
+	queue := func(a Asset) {
+		k := a.URL.String()
+		if _, ok := sheets[k]; ok || a.Kind != AssetStylesheet || !pm.inHost(a.URL) || !pm.robots.allowed(a.URL) {
+			return
+		}
+		sheets[k] = nil
+		next = append(next, a.URL)
+	}
+	for _, p := range pm.pages {
+		for _, a := range p.(*page).assets {
+			queue(a)
+		}
+	}
+
+	// imported stylesheets are fetched a level at a time
+	var lock sync.Mutex
+	for len(next) > 0 && cs.ctx.Err() == nil {
+		urls := next
+		next = nil
+		cs.runAll(maxRequests, urls, func(u *url.URL) {
+			if !cs.wait(u) {
+				return
+			}
+			assets, code, err := fetcher.fetchCSS(cs.ctx, u)
+			lock.Lock()
+			sheets[u.String()] = assets
+			// a cancelled crawl says nothing about the stylesheet
+			if err != nil && cs.ctx.Err() == nil {
+				failed[u.String()] = &checkResult{statusCode: code, err: err}
+			}
+			lock.Unlock()
+		})
+		for _, u := range urls {
+			for _, a := range sheets[u.String()] {
+				queue(a)
+			}
+		}
+	}
+
+	fill := func(a *Asset) {
+		if r := failed[a.URL.String()]; r != nil {
+			a.StatusCode, a.Err = r.statusCode, r.err
+		}
+		a.Assets = sheets[a.URL.String()]
+	}
+	for _, p := range pm.pages {
+		p := p.(*page)
+		seen := map[string]bool{}
+		for _, a := range p.assets {
+			seen[a.URL.String()] = true
+		}
+		// the assets of imported stylesheets follow those of the importing one
+		var add func(sheet *url.URL)
+		add = func(sheet *url.URL) {
+			for _, a := range sheets[sheet.String()] {
+				if seen[a.URL.String()] {
+					continue
+				}
+				seen[a.URL.String()] = true
+				a.Via = sheet
+				fill(&a)
+				p.assets = append(p.assets, a)
+				if a.Kind == AssetStylesheet {
+					add(a.URL)
+				}
+			}
+		}
+		for i, n := 0, len(p.assets); i < n; i++ {
+			fill(&p.assets[i])
+			if p.assets[i].Assets != nil {
+				add(p.assets[i].URL)
+			}
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package crawler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSSRefs(t *testing.T) {
+	css := `@import "base.css";
+@import url('print.css') print;
+@import url(fonts/all.css);
+/* background: url(old.png) */
+body { background: url( "img/bg.png" ) }
+@font-face { src: url(fonts/a.woff2) format("woff2"), url('fonts/a.ttf') }`
+	var refs []string
+	var kinds []AssetKind
+	cssRefs(css, func(ref string, kind AssetKind) {
+		refs = append(refs, ref)
+		kinds = append(kinds, kind)
+	})
+	assert.Equal(t, []string{"base.css", "print.css", "fonts/all.css", "img/bg.png", "fonts/a.woff2", "fonts/a.ttf"}, refs)
+	assert.Equal(t, []AssetKind{AssetStylesheet, AssetStylesheet, AssetStylesheet, AssetImage, AssetFont, AssetFont}, kinds)
+}
+
+func TestCrawlerStylesheets(t *testing.T) {
+	var lock sync.Mutex
+	requests := map[string]int{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requests[r.Method+" "+r.URL.Path]++
+		lock.Unlock()
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<html><head><link href="/css/style.css" rel="stylesheet">
+<link href="http://docrawl.org/style.css" rel="stylesheet"></head><body><a href="/page">Page</a></body></html>`))
+		case "/page":
+			w.Write([]byte(`<html><head><link href="/css/fonts.css" rel="stylesheet"></head></html>`))
+		case "/css/style.css":
+			w.Header().Set("Content-Type", "text/css")
+			w.Write([]byte(`@import "fonts.css"; body { background: url(../img/bg.png) }`))
+		case "/css/fonts.css":
+			w.Header().Set("Content-Type", "text/css")
+			w.Write([]byte(`@import "style.css"; @font-face { src: url(missing.woff2) }`))
+		case "/img/bg.png":
+			w.Write([]byte("PNG"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	c := NewCrawler(2, nil)
+	c.CrawlStylesheets = true
+	c.VerifyAssets = true
+	cr, err := c.Crawl(ts.URL + "/")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, requests["GET /css/style.css"], "each stylesheet is fetched once")
+	assert.Equal(t, 1, requests["GET /css/fonts.css"])
+
+	var urls []string
+	for _, a := range cr.Root().Assets() {
+		urls = append(urls, a.URL.String())
+	}
+	assert.Equal(t, []string{
+		ts.URL + "/css/style.css",
+		"http://docrawl.org/style.css",
+		ts.URL + "/css/fonts.css",
+		ts.URL + "/css/missing.woff2",
+		ts.URL + "/img/bg.png",
+	}, urls)
+
+	assets := cr.Root().Assets()
+	if assert.Equal(t, 2, len(assets[0].Assets)) {
+		assert.Equal(t, ts.URL+"/css/fonts.css", assets[0].Assets[0].URL.String())
+		assert.Equal(t, AssetStylesheet, assets[0].Assets[0].Kind)
+		assert.Equal(t, AssetImage, assets[0].Assets[1].Kind)
+	}
+	assert.Nil(t, assets[0].Via)
+	assert.Nil(t, assets[1].Assets, "stylesheets on other hosts are not fetched")
+	assert.Equal(t, ts.URL+"/css/style.css", assets[2].Via.String())
+	assert.Equal(t, ts.URL+"/css/fonts.css", assets[3].Via.String())
+	assert.Equal(t, AssetFont, assets[3].Kind)
+	assert.True(t, assets[3].Broken(), "assets from stylesheets are verified")
+	assert.Equal(t, 200, assets[4].StatusCode)
+
+	lt := cr.LookupTable()
+	assert.Equal(t, []string{ts.URL + "/css/fonts.css", ts.URL + "/css/style.css", ts.URL + "/img/bg.png", ts.URL + "/css/missing.woff2"}, lt[ts.URL+"/page"].Assets)
+}
+
+func TestCrawlerStylesheetErrors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<html><head><link href="/style.css" rel="stylesheet"></head></html>`))
+		case "/style.css":
+			w.Header().Set("Content-Type", "text/css")
+			w.Write([]byte(`@import "gone.css";`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	c := NewCrawler(2, nil)
+	c.CrawlStylesheets = true
+	cr, err := c.Crawl(ts.URL + "/")
+	assert.NoError(t, err)
+
+	assets := cr.Root().Assets()
+	if assert.Equal(t, 2, len(assets)) {
+		assert.False(t, assets[0].Broken())
+		assert.Equal(t, ts.URL+"/gone.css", assets[1].URL.String())
+		assert.Equal(t, 404, assets[1].StatusCode)
+		assert.True(t, assets[1].Broken(), "a stylesheet that could not be fetched is broken")
+	}
+	assert.Equal(t, []AssetRecord{{ts.URL + "/gone.css", 404, "non 200 status code received: 404"}},
+		cr.LookupTable()[ts.URL+"/"].BrokenAssets)
+}
@@ -0,0 +1,64 @@
+package crawler
+
+// EventType identifies the kind of a crawl Event.
+type EventType int
+
+const (
+	// EventDiscovered is sent when a page is first found, before it is fetched.
+	EventDiscovered EventType = iota
+	// EventFetchStarted is sent just before the fetcher is called for a page.
+	EventFetchStarted
+	// EventFetchFinished is sent once the fetcher returns, with the status code,
+	// the number of attempts and any fetch error.
+	EventFetchFinished
+	// EventCrawlFinished is the last event of a crawl, with the crawl error if it
+	// stopped early. It is not sent for lazy crawls, which have no end.
+	EventCrawlFinished
+	// EventLinkChecked is sent when an external link has been checked, with the
+	// status code and the error if it is broken. It comes before EventCrawlFinished.
+	EventLinkChecked
+)
+
+var eventTypeNames = []string{
+	EventDiscovered:    "discovered",
+	EventFetchStarted:  "fetch started",
+	EventFetchFinished: "fetch finished",
+	EventCrawlFinished: "crawl finished",
+	EventLinkChecked:   "link checked",
+}
+
+func (t EventType) String() string {
+	if t < 0 || int(t) >= len(eventTypeNames) {
+		return "unknown"
+	}
+	return eventTypeNames[t]
+}
+
+// Event is a notification about the progress of a crawl.
+type Event struct {
+	Type EventType
+	// Page is the page the event is about. It is nil for EventCrawlFinished.
+	// Observers should only use the URL of the page, as it may still be being
+	// fetched. The outcome of a fetch is in the other fields.
+	Page Page
+	// StatusCode is the HTTP status code of the final response, or zero if there
+	// was none or the fetcher does not report it.
+	StatusCode int
+	// Attempts is the number of times the page was fetched, counting retries.
+	Attempts int
+	Err      error
+}
+
+// Observer receives the events of a crawl. Observe is called concurrently from the
+// crawler goroutines and should return quickly, as it holds up the crawl.
+type Observer interface {
+	Observe(e Event)
+}
+
+// ObserverFunc is an adapter to allow the use of ordinary functions as an Observer.
+type ObserverFunc func(e Event)
+
+// Observe calls f(e).
+func (f ObserverFunc) Observe(e Event) {
+	f(e)
+}
@@ -0,0 +1,517 @@
+package crawler
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// AssetKind classifies an Asset by what it is used for.
+type AssetKind int
+
+const (
+	// AssetOther is an asset of unknown use, such as a web app manifest.
+	AssetOther AssetKind = iota
+	AssetScript
+	AssetStylesheet
+	AssetImage
+	// AssetMedia is a video or audio file, or a text track for one.
+	AssetMedia
+	AssetFont
+	// AssetFrame is a document embedded in the page, such as that of an iframe.
+	AssetFrame
+)
+
+var assetKindNames = []string{
+	AssetOther:      "other",
+	AssetScript:     "script",
+	AssetStylesheet: "stylesheet",
+	AssetImage:      "image",
+	AssetMedia:      "media",
+	AssetFont:       "font",
+	AssetFrame:      "frame",
+}
+
+func (k AssetKind) String() string {
+	if k < 0 || int(k) >= len(assetKindNames) {
+		return "unknown"
+	}
+	return assetKindNames[k]
+}
+
+// ExtractRule finds the links or assets of a page in the elements matching a
+// CSS selector.
+type ExtractRule struct {
+	// Selector is the CSS selector of the elements.
+	Selector string
+	// Attr is the attribute of the elements that holds a URL.
+	Attr string
+	// Link makes the URLs links to other pages rather than assets.
+	Link bool
+	// Kind is the kind of the assets found.
+	Kind AssetKind
+	// Func, if set, is used instead of Attr and Kind to find the URLs in an
+	// element. It calls add with each URL as it appears in the page, and the kind
+	// of asset that it is.
+	Func func(s *goquery.Selection, add func(ref string, kind AssetKind))
+}
+
+// DefaultExtractRules are the rules an HTTP fetcher uses unless its options have
+// their own. Links and assets are listed in the order of the rules, and then of
+// the elements in the page.
+var DefaultExtractRules = []ExtractRule{
+	{Selector: "a[href]", Attr: "href", Link: true},
+	{Selector: "area[href]", Attr: "href", Link: true},
+	{Selector: "meta[http-equiv][content]", Link: true, Func: extractRefresh},
+
+	{Selector: "script[src]", Attr: "src", Kind: AssetScript},
+	{Selector: "link[href]", Func: extractLink},
+	{Selector: "img[src]", Attr: "src", Kind: AssetImage},
+	{Selector: "img[srcset], picture source[srcset]", Func: extractSrcset},
+	{Selector: "video[poster]", Attr: "poster", Kind: AssetImage},
+	{Selector: "video[src], audio[src], video source[src], audio source[src], track[src]", Attr: "src", Kind: AssetMedia},
+	{Selector: "iframe[src], frame[src]", Attr: "src", Kind: AssetFrame},
+	{Selector: "object[data]", Func: extractByPath("data", AssetFrame)},
+	{Selector: "embed[src]", Func: extractByPath("src", AssetFrame)},
+	{Selector: "[style]", Func: extractStyleAttr},
+	{Selector: "style", Func: extractStyleElement},
+}
+
+// extract finds the links and assets of doc with rules, resolved against base.
+// Only http and https URLs are kept. The link info is in the same order as the
+// links.
+func extract(doc *goquery.Document, base *url.URL, rules []ExtractRule) ([]*url.URL, []LinkInfo, []Asset) {
+	links := make([]*url.URL, 0, 8)
+	infos := make([]LinkInfo, 0, 8)
+	assets := make([]Asset, 0)
+	for _, rule := range rules {
+		doc.Find(rule.Selector).Each(func(n int, s *goquery.Selection) {
+			add := func(ref string, kind AssetKind) {
+				u := resolveRef(base, ref)
+				switch {
+				case u == nil:
+				case rule.Link:
+					links = append(links, u)
+					infos = append(infos, linkInfo(s))
+				default:
+					assets = append(assets, Asset{URL: u, Kind: kind})
+				}
+			}
+			if rule.Func != nil {
+				rule.Func(s, add)
+			} else if ref, _ := s.Attr(rule.Attr); ref != "" {
+				add(ref, rule.Kind)
+			}
+		})
+	}
+	return links, infos, assets
+}
+
+// linkInfo describes the element s of a link.
+func linkInfo(s *goquery.Selection) LinkInfo {
+	li := LinkInfo{Rel: relValues(s)}
+	li.Title, _ = s.Attr("title")
+	li.Text = anchorText(s)
+	if len(s.Nodes) > 0 {
+		li.Path = cssPath(s.Nodes[0])
+		li.Region = linkRegion(s.Nodes[0])
+	}
+	return li
+}
+
+// relValues returns the values of the rel attribute of s in lower case, or nil
+// if it has none.
+func relValues(s *goquery.Selection) []string {
+	rel, ok := s.Attr("rel")
+	if !ok {
+		return nil
+	}
+	return strings.Fields(strings.ToLower(rel))
+}
+
+// anchorText returns the text of a link, or if it has none, its label or the
+// alternative text of its images.
+func anchorText(s *goquery.Selection) string {
+	if text := collapseSpace(s.Text()); text != "" {
+		return text
+	}
+	if label, _ := s.Attr("aria-label"); strings.TrimSpace(label) != "" {
+		return collapseSpace(label)
+	}
+	if alt, _ := s.Attr("alt"); strings.TrimSpace(alt) != "" {
+		return collapseSpace(alt)
+	}
+	var alts []string
+	s.Find("img[alt]").Each(func(n int, img *goquery.Selection) {
+		alt, _ := img.Attr("alt")
+		if alt = collapseSpace(alt); alt != "" {
+			alts = append(alts, alt)
+		}
+	})
+	return strings.Join(alts, " ")
+}
+
+// cssIdentPattern matches ids that can be used in a selector as they are.
+var cssIdentPattern = regexp.MustCompile(`^[A-Za-z_][-A-Za-z0-9_]*$`)
+
+// cssPath returns a CSS selector for the element n, from the nearest ancestor
+// with an id or from the html element. Elements that have siblings of the same
+// type are told apart by their position.
+func cssPath(n *html.Node) string {
+	var parts []string
+	for ; n != nil && n.Type == html.ElementNode; n = n.Parent {
+		if id := nodeAttr(n, "id"); cssIdentPattern.MatchString(id) {
+			parts = append(parts, n.Data+"#"+id)
+			break
+		}
+		part := n.Data
+		nth, count := 0, 0
+		if n.Parent != nil {
+			for c := n.Parent.FirstChild; c != nil; c = c.NextSibling {
+				if c.Type == html.ElementNode && c.Data == n.Data {
+					count++
+					if c == n {
+						nth = count
+					}
+				}
+			}
+		}
+		if count > 1 {
+			part += ":nth-of-type(" + strconv.Itoa(nth) + ")"
+		}
+		parts = append(parts, part)
+	}
+	for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+		parts[i], parts[j] = parts[j], parts[i]
+	}
+	return strings.Join(parts, " > ")
+}
+
+// nodeAttr returns the value of the attribute key of n, or "" if it has none.
+func nodeAttr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// LinkRegion is the part of a page that a link is in.
+type LinkRegion int
+
+const (
+	// RegionNone is for links outside all of the other regions.
+	RegionNone LinkRegion = iota
+	RegionMain
+	RegionNav
+	RegionHeader
+	RegionFooter
+	RegionAside
+)
+
+var linkRegionNames = []string{
+	RegionNone:   "none",
+	RegionMain:   "main",
+	RegionNav:    "nav",
+	RegionHeader: "header",
+	RegionFooter: "footer",
+	RegionAside:  "aside",
+}
+
+func (r LinkRegion) String() string {
+	if r < 0 || int(r) >= len(linkRegionNames) {
+		return "unknown"
+	}
+	return linkRegionNames[r]
+}
+
+var (
+	regionElements = map[string]LinkRegion{
+		"main":   RegionMain,
+		"nav":    RegionNav,
+		"header": RegionHeader,
+		"footer": RegionFooter,
+		"aside":  RegionAside,
+	}
+	regionRoles = map[string]LinkRegion{
+		"main":          RegionMain,
+		"navigation":    RegionNav,
+		"banner":        RegionHeader,
+		"contentinfo":   RegionFooter,
+		"complementary": RegionAside,
+	}
+)
+
+// linkRegion returns the region of the nearest ancestor of n that is one, by
+// its element or its ARIA role.
+func linkRegion(n *html.Node) LinkRegion {
+	for n = n.Parent; n != nil; n = n.Parent {
+		if n.Type != html.ElementNode {
+			continue
+		}
+		if r, ok := regionRoles[strings.ToLower(nodeAttr(n, "role"))]; ok {
+			return r
+		}
+		if r, ok := regionElements[n.Data]; ok {
+			return r
+		}
+	}
+	return RegionNone
+}
+
+// baseURL returns the URL that the links of doc are relative to, which is that
+// of its <base href> if it has one.
+func baseURL(doc *goquery.Document, u *url.URL) *url.URL {
+	href, ok := doc.Find("base[href]").First().Attr("href")
+	if !ok {
+		return u
+	}
+	base, err := u.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return u
+	}
+	return base
+}
+
+// anchors returns the ids of the elements of doc and the names of its <a>
+// elements, which URL fragments can refer to.
+func anchors(doc *goquery.Document) []string {
+	var names []string
+	doc.Find("[id], a[name]").Each(func(n int, s *goquery.Selection) {
+		if id, _ := s.Attr("id"); id != "" {
+			names = append(names, id)
+		}
+		if name, _ := s.Attr("name"); name != "" && goquery.NodeName(s) == "a" {
+			names = append(names, name)
+		}
+	})
+	return names
+}
+
+// robotsDirectives reports whether the robots meta tags of doc or the
+// X-Robots-Tag headers of the response ask for the links of the page not to be
+// followed, and for the page not to be indexed.
+func robotsDirectives(doc *goquery.Document, h http.Header) (nofollow, noindex bool) {
+	var values []string
+	doc.Find("meta[name][content]").Each(func(n int, s *goquery.Selection) {
+		if name, _ := s.Attr("name"); strings.EqualFold(name, "robots") {
+			content, _ := s.Attr("content")
+			values = append(values, content)
+		}
+	})
+	for _, v := range h["X-Robots-Tag"] {
+		// the header may be for a named agent, "googlebot: noindex"
+		if i := strings.IndexByte(v, ':'); i >= 0 && !strings.ContainsAny(v[:i], ", ") {
+			continue
+		}
+		values = append(values, v)
+	}
+	for _, v := range values {
+		for _, d := range strings.Split(strings.ToLower(v), ",") {
+			switch strings.TrimSpace(d) {
+			case "nofollow":
+				nofollow = true
+			case "noindex":
+				noindex = true
+			case "none":
+				nofollow, noindex = true, true
+			}
+		}
+	}
+	return
+}
+
+// resolveRef resolves a URL found in a page, returning nil if it is not an
+// http or https URL.
+func resolveRef(base *url.URL, ref string) *url.URL {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return nil
+	}
+	u, err := base.Parse(ref)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil
+	}
+	return u
+}
+
+// extractRefresh finds the target of a <meta http-equiv="refresh" content="5; url=...">.
+func extractRefresh(s *goquery.Selection, add func(string, AssetKind)) {
+	if equiv, _ := s.Attr("http-equiv"); !strings.EqualFold(equiv, "refresh") {
+		return
+	}
+	content, _ := s.Attr("content")
+	i := strings.IndexAny(content, ";,")
+	if i < 0 {
+		return
+	}
+	ref := strings.TrimSpace(content[i+1:])
+	if len(ref) >= 4 && strings.EqualFold(ref[:3], "url") {
+		if rest := strings.TrimSpace(ref[3:]); strings.HasPrefix(rest, "=") {
+			ref = strings.TrimSpace(rest[1:])
+		}
+	}
+	add(strings.Trim(ref, `'"`), AssetOther)
+}
+
+// extractLink classifies a <link> by its rel, and its as for preloads.
+func extractLink(s *goquery.Selection, add func(string, AssetKind)) {
+	href, _ := s.Attr("href")
+	rel, _ := s.Attr("rel")
+	kind := AssetOther
+	for _, r := range strings.Fields(strings.ToLower(rel)) {
+		switch r {
+		case "stylesheet":
+			kind = AssetStylesheet
+		case "icon", "apple-touch-icon", "mask-icon":
+			kind = AssetImage
+		case "modulepreload":
+			kind = AssetScript
+		case "preload", "prefetch":
+			as, _ := s.Attr("as")
+			kind = preloadKinds[strings.ToLower(as)]
+		}
+	}
+	add(href, kind)
+}
+
+var preloadKinds = map[string]AssetKind{
+	"script": AssetScript,
+	"style":  AssetStylesheet,
+	"image":  AssetImage,
+	"audio":  AssetMedia,
+	"video":  AssetMedia,
+	"track":  AssetMedia,
+	"font":   AssetFont,
+	"iframe": AssetFrame,
+}
+
+// extractSrcset finds the image candidates of a srcset, "small.jpg 1x, large.jpg 2x".
+func extractSrcset(s *goquery.Selection, add func(string, AssetKind)) {
+	srcset, _ := s.Attr("srcset")
+	for _, u := range srcsetURLs(srcset) {
+		add(u, AssetImage)
+	}
+}
+
+// srcsetURLs returns the URLs of the candidates of a srcset the way the HTML
+// standard parses it: a URL runs up to whitespace, so it may contain commas, unless
+// it ends with one. Its descriptors then run up to a comma outside parentheses.
+func srcsetURLs(srcset string) []string {
+	const space = " \t\n\f\r"
+	var urls []string
+	s := srcset
+	for {
+		s = strings.TrimLeft(s, space+",")
+		if s == "" {
+			return urls
+		}
+		end := strings.IndexAny(s, space)
+		if end < 0 {
+			end = len(s)
+		}
+		u := s[:end]
+		s = s[end:]
+		if trimmed := strings.TrimRight(u, ","); trimmed != u {
+			// a comma right after the URL ends a candidate without descriptors
+			urls = append(urls, trimmed)
+			continue
+		}
+		urls = append(urls, u)
+
+		i := 0
+		for depth := 0; i < len(s) && (s[i] != ',' || depth > 0); i++ {
+			switch s[i] {
+			case '(':
+				depth++
+			case ')':
+				depth--
+			}
+		}
+		s = s[i:]
+	}
+}
+
+// extractByPath returns a rule function for attr that guesses the kind of the
+// asset from its file extension, with def for unknown extensions.
+func extractByPath(attr string, def AssetKind) func(*goquery.Selection, func(string, AssetKind)) {
+	return func(s *goquery.Selection, add func(string, AssetKind)) {
+		if ref, _ := s.Attr(attr); ref != "" {
+			add(ref, kindByPath(ref, def))
+		}
+	}
+}
+
+var extensionKinds = map[string]AssetKind{
+	".js":    AssetScript,
+	".css":   AssetStylesheet,
+	".png":   AssetImage,
+	".jpg":   AssetImage,
+	".jpeg":  AssetImage,
+	".gif":   AssetImage,
+	".svg":   AssetImage,
+	".webp":  AssetImage,
+	".avif":  AssetImage,
+	".ico":   AssetImage,
+	".mp4":   AssetMedia,
+	".webm":  AssetMedia,
+	".ogg":   AssetMedia,
+	".mp3":   AssetMedia,
+	".wav":   AssetMedia,
+	".vtt":   AssetMedia,
+	".swf":   AssetMedia,
+	".woff":  AssetFont,
+	".woff2": AssetFont,
+	".ttf":   AssetFont,
+	".otf":   AssetFont,
+	".eot":   AssetFont,
+}
+
+// kindByPath guesses the kind of an asset from the file extension of ref.
+func kindByPath(ref string, def AssetKind) AssetKind {
+	if u, err := url.Parse(ref); err == nil {
+		ref = u.Path
+	}
+	if kind, ok := extensionKinds[strings.ToLower(path.Ext(ref))]; ok {
+		return kind
+	}
+	return def
+}
+
+// cssURLPattern matches url() references in CSS, quoted or not.
+var cssURLPattern = regexp.MustCompile(`url\(\s*(?:'([^']*)'|"([^"]*)"|([^'")\s]*))\s*\)`)
+
+// cssURLs returns the url() references of a piece of CSS.
+func cssURLs(css string) []string {
+	var refs []string
+	for _, m := range cssURLPattern.FindAllStringSubmatch(css, -1) {
+		if ref := m[1] + m[2] + m[3]; ref != "" {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// extractStyleAttr finds the url() references of a style attribute, such as
+// background images.
+func extractStyleAttr(s *goquery.Selection, add func(string, AssetKind)) {
+	style, _ := s.Attr("style")
+	for _, ref := range cssURLs(style) {
+		add(ref, kindByPath(ref, AssetImage))
+	}
+}
+
+// extractStyleElement finds the url() references of a <style> element. They
+// are taken to be images, unless they are fonts by their file extension.
+func extractStyleElement(s *goquery.Selection, add func(string, AssetKind)) {
+	for _, ref := range cssURLs(s.Text()) {
+		add(ref, kindByPath(ref, AssetImage))
+	}
+}
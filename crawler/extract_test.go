@@ -0,0 +1,207 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/html"
+)
+
+const extractPage = `<html><head>
+<meta http-equiv="Refresh" content="5; URL='/next.html'">
+<meta name="description" content="5; url=/not-a-refresh">
+<link rel="stylesheet" href="/main.css">
+<link rel="icon" href="/favicon.ico">
+<link rel="preload" href="/font.woff2" as="font">
+<link rel="manifest" href="/app.webmanifest">
+<script src="/app.js"></script>
+<style>body { background: url("/bg.png") } @font-face { src: url(/f.ttf) }</style>
+</head><body>
+<a href="/page.html">Page</a>
+<a href="mailto:docs@example.com">Mail</a>
+<map><area href="/area.html"></map>
+<img src="/small.jpg" srcset="/small.jpg 1x, /large.jpg 2x">
+<picture><source srcset="/photo.webp"><img src="/photo.jpg"></picture>
+<video src="/clip.mp4" poster="/poster.jpg"><track src="/subs.vtt"></video>
+<audio><source src="/sound.ogg"></audio>
+<iframe src="/embed.html"></iframe>
+<object data="/movie.swf"></object>
+<embed src="/widget.html">
+<div style="background-image: url('/tile.gif')"></div>
+<img src="data:image/gif;base64,R0lGODlhAQABAAAAACw=">
+</body></html>`
+
+func TestExtract(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(extractPage))
+	assert.NoError(t, err)
+	base, _ := url.Parse("http://testhost.local/dir/")
+	links, _, assets := extract(doc, base, DefaultExtractRules)
+
+	var linkPaths []string
+	for _, l := range links {
+		linkPaths = append(linkPaths, l.Path)
+	}
+	assert.Equal(t, []string{"/page.html", "/area.html", "/next.html"}, linkPaths)
+
+	kinds := map[string]AssetKind{}
+	for _, a := range assets {
+		kinds[a.URL.Path] = a.Kind
+	}
+	assert.Equal(t, map[string]AssetKind{
+		"/app.js":          AssetScript,
+		"/main.css":        AssetStylesheet,
+		"/favicon.ico":     AssetImage,
+		"/font.woff2":      AssetFont,
+		"/app.webmanifest": AssetOther,
+		"/small.jpg":       AssetImage,
+		"/large.jpg":       AssetImage,
+		"/photo.webp":      AssetImage,
+		"/photo.jpg":       AssetImage,
+		"/poster.jpg":      AssetImage,
+		"/clip.mp4":        AssetMedia,
+		"/subs.vtt":        AssetMedia,
+		"/sound.ogg":       AssetMedia,
+		"/embed.html":      AssetFrame,
+		"/movie.swf":       AssetMedia,
+		"/widget.html":     AssetFrame,
+		"/tile.gif":        AssetImage,
+		"/bg.png":          AssetImage,
+		"/f.ttf":           AssetFont,
+	}, kinds)
+	assert.Equal(t, "script", AssetScript.String())
+}
+
+func TestSrcsetURLs(t *testing.T) {
+	for _, tc := range []struct {
+		srcset string
+		urls   []string
+	}{
+		{"/small.jpg 1x, /large.jpg 2x", []string{"/small.jpg", "/large.jpg"}},
+		{"/photo.webp", []string{"/photo.webp"}},
+		{"https://cdn.example.com/w_100,h_100/a.jpg 1x, https://cdn.example.com/w_200,h_200/a.jpg 2x",
+			[]string{"https://cdn.example.com/w_100,h_100/a.jpg", "https://cdn.example.com/w_200,h_200/a.jpg"}},
+		{"/a.jpg, /b.jpg 2x", []string{"/a.jpg", "/b.jpg"}},
+		{"/a.jpg,/b.jpg 2x", []string{"/a.jpg,/b.jpg"}},
+		{" /a.jpg 100w,\n\t/b.jpg 200w ", []string{"/a.jpg", "/b.jpg"}},
+		{"/a.jpg (max-width: 10px, 1x), /b.jpg", []string{"/a.jpg", "/b.jpg"}},
+		{", ,", nil},
+	} {
+		assert.Equal(t, tc.urls, srcsetURLs(tc.srcset), tc.srcset)
+	}
+}
+
+func TestExtractRulesOption(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><body><a href="/page.html">Page</a><div data-src="/lazy.png"></div></body></html>`))
+	}))
+	defer ts.Close()
+
+	rules := append([]ExtractRule{}, DefaultExtractRules...)
+	rules = append(rules, ExtractRule{Selector: "[data-src]", Attr: "data-src", Kind: AssetImage})
+	f := NewHTTPFetcher(nil, HTTPOptions{ExtractRules: rules})
+	u, _ := url.Parse(ts.URL + "/")
+	r := f.Fetch(context.Background(), u)
+	assert.NoError(t, r.Err)
+	assert.Equal(t, 1, len(r.Links))
+	if assert.Equal(t, 1, len(r.Assets)) {
+		assert.Equal(t, ts.URL+"/lazy.png", r.Assets[0].URL.String())
+		assert.Equal(t, AssetImage, r.Assets[0].Kind)
+	}
+}
+
+func TestExtractBaseAndRel(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(`<html><head>
+<base href="http://cdn.testhost.local/v2/">
+</head><body>
+<a href="page.html" rel="Sponsored nofollow">Ad</a>
+<a href="/about.html">About</a>
+<img src="logo.png">
+</body></html>`))
+	assert.NoError(t, err)
+	u, _ := url.Parse("http://testhost.local/docs/index.html")
+	links, infos, assets := extract(doc, baseURL(doc, u), DefaultExtractRules)
+
+	if assert.Equal(t, 2, len(links)) {
+		assert.Equal(t, "http://cdn.testhost.local/v2/page.html", links[0].String(), "links are relative to <base>")
+		assert.Equal(t, "http://cdn.testhost.local/about.html", links[1].String())
+	}
+	if assert.Equal(t, 2, len(infos)) {
+		assert.Equal(t, []string{"sponsored", "nofollow"}, infos[0].Rel)
+		assert.True(t, infos[0].HasRel("nofollow"))
+		assert.False(t, infos[1].HasRel("nofollow"))
+	}
+	assert.Equal(t, "http://cdn.testhost.local/v2/logo.png", assets[0].URL.String())
+
+	doc, _ = goquery.NewDocumentFromReader(strings.NewReader(`<html><body></body></html>`))
+	assert.Equal(t, u, baseURL(doc, u))
+}
+
+func TestRobotsDirectives(t *testing.T) {
+	tests := []struct {
+		page              string
+		header            http.Header
+		nofollow, noindex bool
+	}{
+		{`<meta name="robots" content="index, follow">`, nil, false, false},
+		{`<meta name="ROBOTS" content="NOFOLLOW">`, nil, true, false},
+		{`<meta name="robots" content="noindex">`, nil, false, true},
+		{`<meta name="robots" content="none">`, nil, true, true},
+		{`<meta name="description" content="noindex">`, nil, false, false},
+		{``, http.Header{"X-Robots-Tag": {"noindex, nofollow"}}, true, true},
+		{``, http.Header{"X-Robots-Tag": {"otherbot: noindex"}}, false, false},
+	}
+	for _, tt := range tests {
+		doc, _ := goquery.NewDocumentFromReader(strings.NewReader("<html><head>" + tt.page + "</head></html>"))
+		nofollow, noindex := robotsDirectives(doc, tt.header)
+		assert.Equal(t, tt.nofollow, nofollow, "%s %v", tt.page, tt.header)
+		assert.Equal(t, tt.noindex, noindex, "%s %v", tt.page, tt.header)
+	}
+}
+
+func TestExtractLinkInfo(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(`<html><body>
+<header><nav><ul>
+<li><a href="/">Home</a></li>
+<li><a href="/docs" title="Documentation">Docs</a></li>
+</ul></nav></header>
+<div role="main" id="content"><p><a href="/more">click
+  here</a></p><a href="/logo"><img src="logo.png" alt="Logo"></a></div>
+<footer><a href="/legal" aria-label="Legal notice"></a></footer>
+<map><area href="/area" alt="Area"></map>
+</body></html>`))
+	assert.NoError(t, err)
+	u, _ := url.Parse("http://testhost.local/")
+	_, infos, _ := extract(doc, u, DefaultExtractRules)
+
+	assert.Equal(t, []LinkInfo{
+		{Text: "Home", Path: "html > body > header > nav > ul > li:nth-of-type(1) > a", Region: RegionNav},
+		{Text: "Docs", Title: "Documentation", Path: "html > body > header > nav > ul > li:nth-of-type(2) > a", Region: RegionNav},
+		{Text: "click here", Path: "div#content > p > a", Region: RegionMain},
+		{Text: "Logo", Path: "div#content > a", Region: RegionMain},
+		{Text: "Legal notice", Path: "html > body > footer > a", Region: RegionFooter},
+		{Text: "Area", Path: "html > body > map > area"},
+	}, infos)
+	assert.Equal(t, "footer", RegionFooter.String())
+
+	// elements of fragments may have no parent
+	a := &html.Node{Type: html.ElementNode, Data: "a"}
+	assert.Equal(t, "a", cssPath(a))
+	span := &html.Node{Type: html.ElementNode, Data: "span"}
+	a.AppendChild(span)
+	assert.Equal(t, "a > span", cssPath(span))
+}
+
+func TestAnchors(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(`<html><body>
+<h2 id="install">Install</h2><a name="legacy"></a><a id="both" name="old">x</a>
+<div name="notanchor"></div>
+</body></html>`))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"install", "legacy", "both", "old"}, anchors(doc))
+}
@@ -1,71 +1,145 @@
 package crawler
 
 import (
-	"fmt"
+	"context"
 	"net/http"
 	"net/url"
-
-	"github.com/PuerkitoBio/goquery"
+	"time"
 )
 
-// FetchPageHTTP is a simple http only crawler fetcher. It populates the Page Assets by
-// scraping the page with the standard golang HTML parser.
-func FetchPageHTTP(p Page) []*url.URL {
-	res, err := http.Get(p.URL().String())
-	if err != nil {
-		p.SetError(err)
-		return nil
+// Fetcher fetches pages for the crawler by some means.
+type Fetcher interface {
+	// Fetch fetches the page at u. It should abandon any outstanding requests once
+	// ctx is done. Any failure is reported in the Err field of the result.
+	Fetch(ctx context.Context, u *url.URL) *FetchResult
+}
+
+// FetcherFunc is an adapter to allow the use of ordinary functions as a Fetcher.
+type FetcherFunc func(ctx context.Context, u *url.URL) *FetchResult
+
+// Fetch calls f(ctx, u).
+func (f FetcherFunc) Fetch(ctx context.Context, u *url.URL) *FetchResult {
+	return f(ctx, u)
+}
+
+// PageFetcherFunc is the older style of fetcher function that fills out a Page using
+// its setters and returns the links. It is adapted to a Fetcher, so that functions
+// like FetchPageHTTP can still be used with the crawler. The function is not given
+// the context of the crawl, so its requests are not aborted when the crawl is
+// cancelled; use a Fetcher such as HTTPFetcher for that.
+type PageFetcherFunc func(p Page) []*url.URL
+
+// Fetch runs f on a scratch page for u and collects the result.
+func (f PageFetcherFunc) Fetch(ctx context.Context, u *url.URL) *FetchResult {
+	p := newEagerPage(u)
+	start := time.Now()
+	links := f(p)
+	res := &FetchResult{
+		URL:       u,
+		Redirects: p.redirects,
+		Links:     links,
+		Assets:    p.assets,
+		Timings:   Timings{Start: start, Total: time.Since(start)},
+		Err:       p.err,
 	}
-	if res.StatusCode != 200 {
-		p.SetError(fmt.Errorf("non 200 status code received: %v", res.StatusCode))
-		return nil
+	if len(p.redirects) > 0 {
+		res.URL = p.redirects[len(p.redirects)-1].URL
 	}
+	return res
+}
 
-	doc, err := goquery.NewDocumentFromResponse(res)
-	if err != nil {
-		p.SetError(err)
-		return nil
-	}
-	p.SetError(nil)
+// FetchResult is the outcome of fetching a single page.
+type FetchResult struct {
+	// URL is the final URL of the page, after any redirects.
+	URL *url.URL
+	// StatusCode and Header are from the final response, if there was one.
+	StatusCode int
+	Header     http.Header
+	// Redirects is the chain of redirects that was followed.
+	Redirects []Redirect
+	// Links are the absolute URLs of the pages linked from the page, on any host.
+	Links []*url.URL
+	// LinkInfo describes the elements of the links, in the same order. It may be
+	// shorter than Links, or nil, if nothing is known about them.
+	LinkInfo []LinkInfo
+	Assets   []Asset
+	// NoFollow and NoIndex are the directives of robots meta tags and
+	// X-Robots-Tag headers for the page.
+	NoFollow bool
+	NoIndex  bool
+	// Meta is the metadata of the page, as far as the fetcher knows it.
+	Meta PageMeta
+	// Anchors are the ids and anchor names in the page that fragments can refer to.
+	Anchors []string
+	Timings
+	Err error
+}
 
-	links := make([]*url.URL, 0, 8)
-	doc.Find("a[href]").Each(func(n int, s *goquery.Selection) {
-		href, _ := s.Attr("href")
-		if len(href) == 0 {
-			return
-		}
-		u, err := url.Parse(href)
-		if err != nil {
-			return
-		}
-		if len(u.Scheme) > 0 && u.Scheme != "http" && u.Scheme != "https" {
-			return
-		}
-		u = p.URL().ResolveReference(u)
+// LinkInfo describes the element of a link.
+type LinkInfo struct {
+	// Text is the text of the link, or the alternative text of its images if it
+	// has none, with white space collapsed.
+	Text string
+	// Title is the title attribute of the link.
+	Title string
+	// Rel are the values of the rel attribute, in lower case.
+	Rel []string
+	// Path is a CSS selector for the element, which gives its position in the page.
+	Path string
+	// Region is the part of the page the link is in.
+	Region LinkRegion
+	// Fragment is the fragment of the link URL, which is not part of the URL of
+	// the linked page.
+	Fragment string
+}
 
-		if u.Host == p.URL().Host {
-			links = append(links, u)
-		}
-	})
+// known reports whether anything is known about the link.
+func (li LinkInfo) known() bool {
+	return li.Text != "" || li.Title != "" || len(li.Rel) > 0 || li.Path != "" || li.Region != RegionNone || li.Fragment != ""
+}
 
-	assets := make([]Asset, 0)
-	assetSels := [][2]string{
-		{"script[src]", "src"},
-		{"link[href]", "href"},
-		{"img[src]", "src"},
+// HasRel reports whether the link has the rel value.
+func (li LinkInfo) HasRel(rel string) bool {
+	for _, r := range li.Rel {
+		if r == rel {
+			return true
+		}
 	}
-	for _, selInfo := range assetSels {
-		doc.Find(selInfo[0]).Each(func(n int, s *goquery.Selection) {
-			src, _ := s.Attr(selInfo[1])
-			if len(src) == 0 {
-				return
-			}
-			assetURL, _ := p.URL().Parse(src)
-			if assetURL != nil {
-				assets = append(assets, assetURL)
-			}
-		})
+	return false
+}
+
+// Timings records how long a fetch took.
+type Timings struct {
+	Start time.Time
+	// FirstByte is the time until the final response headers were received.
+	FirstByte time.Duration
+	// Total is the time until the page was completely fetched and processed.
+	Total time.Duration
+}
+
+// fill records the result in p using its fetcher setters and returns the links.
+// The status code is only recorded for crawler pages.
+func (r *FetchResult) fill(p Page) []*url.URL {
+	if pp, ok := p.(*page); ok {
+		pp.statusCode = r.StatusCode
 	}
-	p.SetAssets(assets)
-	return links
+	p.SetRedirects(r.Redirects)
+	p.SetError(r.Err)
+	p.SetAssets(r.Assets)
+	return r.Links
+}
+
+// HTTPFetcher is the default Fetcher. It uses the default HTTP client settings.
+var HTTPFetcher Fetcher = defaultHTTPFetcher
+
+// FetchPageHTTP is a simple http only crawler fetcher. It populates the Page Assets by
+// scraping the page with the standard golang HTML parser. Use HTTPFetcher or
+// FetchHTTP for requests that are aborted with the crawl.
+func FetchPageHTTP(p Page) []*url.URL {
+	return FetchHTTP(context.Background(), p.URL()).fill(p)
+}
+
+// FetchHTTP fetches the page at u with HTTPFetcher.
+func FetchHTTP(ctx context.Context, u *url.URL) *FetchResult {
+	return defaultHTTPFetcher.Fetch(ctx, u)
 }
@@ -1,7 +1,11 @@
 package crawler
 
 import (
+	"context"
+	"io/ioutil"
+	"strings"
 	"testing"
+	"time"
 
 	"net/http"
 	"net/http/httptest"
@@ -79,7 +83,7 @@ func TestFetchPageHTTP(t *testing.T) {
 				}
 				for i, a := range p.Assets() {
 					uu, _ := baseURL.Parse(tt.assets[i])
-					if *(*url.URL)(a) != *uu {
+					if *a.URL != *uu {
 						return false
 					}
 				}
@@ -92,3 +96,119 @@ func TestFetchPageHTTP(t *testing.T) {
 		testOne(tt)
 	}
 }
+
+func TestFetchPageHTTPRedirects(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a":
+			http.Redirect(w, r, "/b", http.StatusMovedPermanently)
+		case "/b":
+			http.Redirect(w, r, "/c/", http.StatusFound)
+		case "/c/":
+			w.Write([]byte("<html><body><a href=\"page.html\"></a></body></html>"))
+		case "/loop1":
+			http.Redirect(w, r, "/loop2", http.StatusFound)
+		case "/loop2":
+			http.Redirect(w, r, "/loop1", http.StatusFound)
+		}
+	}))
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL + "/a")
+	p := newEagerPage(u)
+	links := FetchPageHTTP(p)
+
+	assert.NoError(t, p.Error())
+	if assert.Equal(t, 2, len(p.Redirects()), "all redirect hops are recorded") {
+		assert.Equal(t, 301, p.Redirects()[0].StatusCode)
+		assert.Equal(t, ts.URL+"/b", p.Redirects()[0].URL.String())
+		assert.Equal(t, 302, p.Redirects()[1].StatusCode)
+		assert.Equal(t, ts.URL+"/c/", p.Redirects()[1].URL.String())
+	}
+	if assert.Equal(t, 1, len(links)) {
+		assert.Equal(t, ts.URL+"/c/page.html", links[0].String(), "links are resolved relative to the final URL")
+	}
+
+	u, _ = url.Parse(ts.URL + "/loop1")
+	p = newEagerPage(u)
+	FetchPageHTTP(p)
+	assert.Equal(t, ErrRedirectLoop, p.Error(), "redirect loops are an error")
+	assert.Equal(t, 2, len(p.Redirects()))
+}
+
+func TestFetchHTTP(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+			return
+		}
+		w.Header().Set("X-Test", "yes")
+		w.Write([]byte("<html><body><a href=\"p1\"><img src=\"i.png\"></a></body></html>"))
+	}))
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL + "/old")
+	r := FetchHTTP(context.Background(), u)
+
+	assert.NoError(t, r.Err)
+	assert.Equal(t, ts.URL+"/new", r.URL.String(), "the final URL is reported")
+	assert.Equal(t, 200, r.StatusCode)
+	assert.Equal(t, "yes", r.Header.Get("X-Test"))
+	assert.Equal(t, 1, len(r.Redirects))
+	assert.Equal(t, 1, len(r.Links))
+	assert.Equal(t, 1, len(r.Assets))
+	assert.False(t, r.Start.IsZero())
+	assert.True(t, r.FirstByte <= r.Total)
+}
+
+func TestNewHTTPFetcher(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+		case "/big":
+			w.Write([]byte("<html><body><a href=\"p1\"></a>"))
+			w.Write([]byte(strings.Repeat(" ", 1024)))
+			w.Write([]byte("<a href=\"p2\"></a></body></html>"))
+		default:
+			w.Write([]byte("<html><body>" + r.UserAgent() + " " + r.Header.Get("X-Token") + "</body></html>"))
+		}
+	}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+
+	r := NewHTTPFetcher(nil, HTTPOptions{}).Fetch(context.Background(), u)
+	assert.Error(t, r.Err, "self-signed certificates are rejected by default")
+
+	var seen string
+	client := &http.Client{Transport: &http.Transport{}}
+	f := NewHTTPFetcher(client, HTTPOptions{
+		UserAgent:          "testbot/1.0",
+		Header:             http.Header{"X-Token": {"secret"}},
+		Timeout:            50 * time.Millisecond,
+		MaxBodySize:        512,
+		InsecureSkipVerify: true,
+	})
+	assert.Nil(t, client.CheckRedirect, "the given client is not modified")
+	if tc := client.Transport.(*http.Transport).TLSClientConfig; tc != nil {
+		assert.False(t, tc.InsecureSkipVerify, "the given transport is not modified")
+	}
+
+	ff := f.(*httpFetcher)
+	res, _, err := ff.get(context.Background(), u)
+	if assert.NoError(t, err, "certificate verification can be disabled") {
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		seen = string(body)
+	}
+	assert.Contains(t, seen, "testbot/1.0 secret", "user agent and extra headers are sent")
+
+	slow, _ := u.Parse("/slow")
+	r = f.Fetch(context.Background(), slow)
+	assert.Error(t, r.Err, "requests time out")
+
+	big, _ := u.Parse("/big")
+	r = f.Fetch(context.Background(), big)
+	assert.NoError(t, r.Err)
+	assert.Equal(t, 1, len(r.Links), "the body is truncated")
+}
@@ -0,0 +1,230 @@
+package crawler
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// maxRedirects is the number of redirects followed before giving up, the same as the
+// net/http default.
+const maxRedirects = 10
+
+var (
+	// ErrRedirectLoop is the page error for a redirect chain that revisits a URL.
+	ErrRedirectLoop = errors.New("redirect loop")
+	// ErrTooManyRedirects is the page error for a redirect chain that is too long.
+	ErrTooManyRedirects = errors.New("too many redirects")
+)
+
+// HTTPOptions configures the requests made by a fetcher from NewHTTPFetcher.
+type HTTPOptions struct {
+	// UserAgent is sent as the User-Agent header, if not empty.
+	UserAgent string
+	// Header holds extra headers sent with every request.
+	Header http.Header
+	// Timeout limits the time taken by each page fetch, including redirects and
+	// reading the body. Zero means no limit beyond that of the client.
+	Timeout time.Duration
+	// MaxBodySize limits how much of a page is read. Longer pages are truncated.
+	// Zero means no limit.
+	MaxBodySize int64
+	// ExtractRules find the links and assets of pages instead of DefaultExtractRules,
+	// if not nil. To add to the default rules, append to a copy of them.
+	ExtractRules []ExtractRule
+	// InsecureSkipVerify disables TLS certificate verification, for staging
+	// servers with self-signed certificates. It only applies when the client
+	// transport is nil or an *http.Transport.
+	InsecureSkipVerify bool
+
+	// Cookies keeps cookies across all requests of the fetcher, in a new cookie jar
+	// if the client has none.
+	Cookies bool
+	// Credentials, if set, authenticate requests to their host.
+	Credentials *Credentials
+	// LoginURL, if set, receives LoginForm in a POST before the first request, to
+	// start a session for the crawl. It implies Cookies.
+	LoginURL  string
+	LoginForm url.Values
+}
+
+// httpFetcher is the Fetcher that fetches and scrapes pages over HTTP.
+type httpFetcher struct {
+	client    *http.Client
+	opts      HTTPOptions
+	formLogin *formLogin
+}
+
+var defaultHTTPFetcher = NewHTTPFetcher(nil, HTTPOptions{}).(*httpFetcher)
+
+// NewHTTPFetcher creates an HTTP Fetcher that makes its requests with a copy of
+// client, or of http.DefaultClient if client is nil. The fetcher follows and
+// records redirects itself, so the CheckRedirect function of client is not used.
+func NewHTTPFetcher(client *http.Client, opts HTTPOptions) Fetcher {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	c := *client
+	c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	if opts.InsecureSkipVerify {
+		t, ok := c.Transport.(*http.Transport)
+		if c.Transport == nil {
+			t, ok = http.DefaultTransport.(*http.Transport)
+		}
+		if ok {
+			t = t.Clone()
+			if t.TLSClientConfig == nil {
+				t.TLSClientConfig = &tls.Config{}
+			}
+			t.TLSClientConfig.InsecureSkipVerify = true
+			c.Transport = t
+		}
+	}
+	if (opts.Cookies || opts.LoginURL != "") && c.Jar == nil {
+		// cookiejar.New never fails without options
+		c.Jar, _ = cookiejar.New(nil)
+	}
+	return &httpFetcher{client: &c, opts: opts, formLogin: &formLogin{}}
+}
+
+// setHeaders adds the configured headers and credentials to req.
+func (f *httpFetcher) setHeaders(req *http.Request) {
+	for k, v := range f.opts.Header {
+		req.Header[k] = v
+	}
+	if f.opts.UserAgent != "" {
+		req.Header.Set("User-Agent", f.opts.UserAgent)
+	}
+	f.opts.Credentials.apply(req)
+}
+
+// withTimeout returns ctx limited to the Timeout of the options, if there is one,
+// and the function that releases it.
+func (f *httpFetcher) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if f.opts.Timeout > 0 {
+		return context.WithTimeout(ctx, f.opts.Timeout)
+	}
+	return ctx, func() {}
+}
+
+func isRedirect(statusCode int) bool {
+	switch statusCode {
+	case 301, 302, 303, 307, 308:
+		return true
+	}
+	return false
+}
+
+// get requests u, following and recording any redirects.
+// The redirects are returned even if there is an error.
+func (f *httpFetcher) get(ctx context.Context, u *url.URL) (*http.Response, []Redirect, error) {
+	return f.do(ctx, "GET", u)
+}
+
+// do is get with any request method.
+func (f *httpFetcher) do(ctx context.Context, method string, u *url.URL) (*http.Response, []Redirect, error) {
+	if err := f.login(ctx); err != nil {
+		return nil, nil, err
+	}
+	var redirects []Redirect
+	seen := map[string]bool{u.String(): true}
+	for {
+		req, err := http.NewRequest(method, u.String(), nil)
+		if err != nil {
+			return nil, redirects, err
+		}
+		f.setHeaders(req)
+		res, err := f.client.Do(req.WithContext(ctx))
+		if err != nil || !isRedirect(res.StatusCode) {
+			return res, redirects, err
+		}
+		loc, err := res.Location()
+		res.Body.Close()
+		if err != nil {
+			return nil, redirects, err
+		}
+		redirects = append(redirects, Redirect{StatusCode: res.StatusCode, URL: loc})
+		if seen[loc.String()] {
+			return nil, redirects, ErrRedirectLoop
+		}
+		if len(redirects) >= maxRedirects {
+			return nil, redirects, ErrTooManyRedirects
+		}
+		seen[loc.String()] = true
+		u = loc
+	}
+}
+
+// Fetch fetches the page at u and scrapes it for links and assets with the standard
+// golang HTML parser. Redirects are followed and recorded, and links are resolved
+// relative to the final URL.
+func (f *httpFetcher) Fetch(ctx context.Context, u *url.URL) *FetchResult {
+	r := &FetchResult{URL: u}
+	r.Start = time.Now()
+	defer func() {
+		r.Total = time.Since(r.Start)
+	}()
+	ctx, cancel := f.withTimeout(ctx)
+	defer cancel()
+
+	res, redirects, err := f.get(ctx, u)
+	r.Redirects = redirects
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	defer res.Body.Close()
+	r.FirstByte = time.Since(r.Start)
+	r.URL = res.Request.URL
+	r.StatusCode = res.StatusCode
+	r.Header = res.Header
+	responseMeta(&r.Meta, res, r.FirstByte)
+	if res.StatusCode != 200 {
+		r.Err = fmt.Errorf("non 200 status code received: %v", res.StatusCode)
+		return r
+	}
+
+	body := &countingReader{r: res.Body}
+	if f.opts.MaxBodySize > 0 {
+		body.r = io.LimitReader(body.r, f.opts.MaxBodySize)
+	}
+	doc, err := goquery.NewDocumentFromReader(body)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	if r.Meta.ContentLength < 0 {
+		r.Meta.ContentLength = body.n
+	}
+	rules := f.opts.ExtractRules
+	if rules == nil {
+		rules = DefaultExtractRules
+	}
+	r.Links, r.LinkInfo, r.Assets = extract(doc, baseURL(doc, r.URL), rules)
+	r.NoFollow, r.NoIndex = robotsDirectives(doc, res.Header)
+	htmlMeta(&r.Meta, doc, baseURL(doc, r.URL))
+	r.Anchors = anchors(doc)
+	return r
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,49 @@
+package crawler
+
+import (
+	"net/url"
+	"sync"
+)
+
+// lazyLoader fetches a lazy page the first time it is needed.
+type lazyLoader struct {
+	once sync.Once
+	cs   *crawlerState
+}
+
+// newLazyPage creates a page that is fetched when its links, assets or error are
+// first asked for. The other accessors report the state of the page so far, so
+// URL, Status and Depth can be used to decide where to walk without fetching.
+func newLazyPage(u *url.URL, cs *crawlerState) *page {
+	p := newEagerPage(u)
+	p.lazy = &lazyLoader{cs: cs}
+	return p
+}
+
+// lockState locks the pageMap of a lazy page, for reading the state that is
+// reported while it may be fetched, and returns the function that unlocks it.
+// Eager pages are only read once the crawl is done, so nothing is locked for them.
+func (p *page) lockState() func() {
+	if p.lazy == nil {
+		return func() {}
+	}
+	pm := p.lazy.cs.pageMap
+	pm.lock.Lock()
+	return pm.lock.Unlock
+}
+
+// load fetches a lazy page, blocking until it is fetched. It does nothing for
+// eager pages.
+func (p *page) load() {
+	if p.lazy == nil {
+		return
+	}
+	p.lazy.once.Do(func() {
+		cs := p.lazy.cs
+		// pages beyond the limits or blocked by robots are never fetched
+		if !cs.pageMap.claim(p) || !cs.acquire() {
+			return
+		}
+		cs.fetch(p)
+	})
+}
@@ -0,0 +1,147 @@
+package crawler
+
+import (
+	"net/url"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLazyPageLinks(t *testing.T) {
+	fetcher := func(p Page) []*url.URL {
+		return mapURLs(p.URL(), pages[p.URL().RequestURI()])
+	}
+	testPageLinks(t, func() (Page, []Page) {
+		c := NewCrawler(1, PageFetcherFunc(fetcher))
+		c.Lazy = true
+		cr, _ := c.Crawl("http://testhost.local/")
+		p := cr.Root().(*page)
+		p.load()
+		return p, p.linked
+	})
+}
+
+func TestCrawlerLazy(t *testing.T) {
+	var numFetches uint32
+	fetcher := func(p Page) []*url.URL {
+		atomic.AddUint32(&numFetches, 1)
+		return mapURLs(p.URL(), pages[p.URL().RequestURI()])
+	}
+
+	c := NewCrawler(1, PageFetcherFunc(fetcher))
+	c.Lazy = true
+	cr, err := c.Crawl("http://testhost.local/")
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(0), numFetches, "nothing is fetched up front")
+	assert.Equal(t, PageUnfetched, cr.Root().Status())
+
+	links := cr.Root().Links()
+	assert.Equal(t, uint32(1), numFetches, "Links() fetches the page")
+	assert.Equal(t, 3, len(links))
+	assert.Equal(t, PageFetched, cr.Root().Status())
+	cr.Root().Links()
+	assert.Equal(t, uint32(1), numFetches, "pages are fetched once")
+
+	// walk only page3 and what it links to
+	var p3 Page
+	for _, p := range links {
+		if strings.HasSuffix(p.URL().Path, "page3.html") {
+			p3 = p
+		}
+	}
+	for p := range p3.GenerateLinks() {
+		p.Links()
+	}
+	assert.Equal(t, uint32(3), numFetches, "only the walked pages are fetched")
+	assert.Equal(t, PageUnfetched, links[0].Status())
+	assert.Equal(t, 6, len(cr.LookupTable()), "the lookup table has the pages found so far")
+}
+
+func TestCrawlerLazyConcurrentWalk(t *testing.T) {
+	fetcher := func(p Page) []*url.URL {
+		runtime.Gosched()
+		return mapURLs(p.URL(), pages[p.URL().RequestURI()])
+	}
+
+	c := NewCrawler(2, PageFetcherFunc(fetcher))
+	c.Lazy = true
+	cr, _ := c.Crawl("http://testhost.local/")
+
+	// the walks steer by the status and depth of pages the other may be fetching
+	var wg sync.WaitGroup
+	walked := make([]int, 2)
+	for i := range walked {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			seen := map[Page]bool{}
+			var walk func(p Page)
+			walk = func(p Page) {
+				seen[p] = true
+				walked[i]++
+				for _, lp := range p.Links() {
+					if !seen[lp] && lp.Status() != PageExternal && lp.Depth() >= 0 && lp.Attempts() <= 1 {
+						lp.Canonical()
+						lp.Redirects()
+						walk(lp)
+					}
+				}
+			}
+			walk(cr.Root())
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, []int{len(pages), len(pages)}, walked, "both walks reach every page")
+	for _, pr := range cr.LookupTable() {
+		assert.Equal(t, "", pr.Status)
+	}
+}
+
+func TestCrawlerLazyConcurrency(t *testing.T) {
+	var numConcurrent, maxConcurrent int32
+	fetcher := func(p Page) []*url.URL {
+		cur := atomic.AddInt32(&numConcurrent, 1)
+		for {
+			old := atomic.SwapInt32(&maxConcurrent, cur)
+			if old <= cur {
+				break
+			}
+			cur = old
+		}
+		defer atomic.AddInt32(&numConcurrent, -1)
+		runtime.Gosched()
+		return mapURLs(p.URL(), pages[p.URL().RequestURI()])
+	}
+
+	c := NewCrawler(2, PageFetcherFunc(fetcher))
+	c.Lazy = true
+	cr, _ := c.Crawl("http://testhost.local/")
+
+	var wg sync.WaitGroup
+	var walk func(p Page)
+	seen := map[Page]bool{}
+	var lock sync.Mutex
+	walk = func(p Page) {
+		defer wg.Done()
+		for _, lp := range p.Links() {
+			lock.Lock()
+			if !seen[lp] {
+				seen[lp] = true
+				wg.Add(1)
+				go walk(lp)
+			}
+			lock.Unlock()
+		}
+	}
+	wg.Add(1)
+	walk(cr.Root())
+	wg.Wait()
+
+	assert.Equal(t, len(pages), len(cr.LookupTable()), "the whole site was walked")
+	assert.True(t, maxConcurrent <= 2, "request concurrency is within limits")
+}
@@ -0,0 +1,124 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// checkResult is the outcome of checking that a URL can be retrieved.
+type checkResult struct {
+	statusCode    int
+	header        http.Header
+	contentLength int64
+	redirects     []Redirect
+	duration      time.Duration
+	err           error
+}
+
+// check requests u to see whether it can be retrieved, with HEAD and then with
+// GET if that fails, as some servers do not support HEAD. The result is that of
+// the final response, with an error if u can not be retrieved.
+func (f *httpFetcher) check(ctx context.Context, u *url.URL) *checkResult {
+	ctx, cancel := f.withTimeout(ctx)
+	defer cancel()
+	var r *checkResult
+	for _, method := range []string{"HEAD", "GET"} {
+		r = f.checkMethod(ctx, method, u)
+		if r.err == nil || ctx.Err() != nil {
+			break
+		}
+	}
+	return r
+}
+
+func (f *httpFetcher) checkMethod(ctx context.Context, method string, u *url.URL) *checkResult {
+	start := time.Now()
+	res, redirects, err := f.do(ctx, method, u)
+	r := &checkResult{redirects: redirects, contentLength: -1, err: err}
+	if err != nil {
+		r.duration = time.Since(start)
+		return r
+	}
+	// the body of a GET is not needed
+	res.Body.Close()
+	r.duration = time.Since(start)
+	r.statusCode = res.StatusCode
+	r.header = res.Header
+	r.contentLength = res.ContentLength
+	if res.StatusCode >= 400 {
+		r.err = fmt.Errorf("status code received: %v", res.StatusCode)
+	}
+	return r
+}
+
+// checkAll checks each of urls with checker, making at most maxRequests
+// simultaneous requests within the rate limits of their hosts. The results are
+// keyed by URL, and URLs that are not checked before the crawl is cancelled have
+// none.
+func (cs *crawlerState) checkAll(checker *httpFetcher, maxRequests int, urls []*url.URL) map[string]*checkResult {
+	results := make(map[string]*checkResult, len(urls))
+	var lock sync.Mutex
+	cs.runAll(maxRequests, urls, func(u *url.URL) {
+		if !cs.wait(u) {
+			return
+		}
+		r := checker.check(cs.ctx, u)
+		if cs.ctx.Err() != nil {
+			return
+		}
+		lock.Lock()
+		results[u.String()] = r
+		lock.Unlock()
+	})
+	return results
+}
+
+// runAll calls do for each of urls, with at most maxRequests calls running at
+// once, and returns when they are done. No more calls are started once the crawl
+// is cancelled.
+func (cs *crawlerState) runAll(maxRequests int, urls []*url.URL, do func(u *url.URL)) {
+	semaphore := make(chan sentinel, maxRequests)
+	var wg sync.WaitGroup
+	for _, u := range urls {
+		select {
+		case semaphore <- sentinel{}:
+		case <-cs.ctx.Done():
+		}
+		if cs.ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(u *url.URL) {
+			defer wg.Done()
+			do(u)
+			<-semaphore
+		}(u)
+	}
+	wg.Wait()
+}
+
+// checkLinks checks all external pages with checker, making at most maxRequests
+// simultaneous requests. Pages that are not checked before the crawl is cancelled
+// are left as they are.
+func (cs *crawlerState) checkLinks(checker *httpFetcher, maxRequests int) {
+	var external []*page
+	var urls []*url.URL
+	for _, p := range cs.pageMap.pages {
+		if p := p.(*page); p.status == PageExternal {
+			external = append(external, p)
+			urls = append(urls, p.url)
+		}
+	}
+
+	results := cs.checkAll(checker, maxRequests, urls)
+	for _, p := range external {
+		if r := results[p.url.String()]; r != nil {
+			p.statusCode, p.redirects, p.err = r.statusCode, r.redirects, r.err
+			cs.emit(Event{Type: EventLinkChecked, Page: p, StatusCode: r.statusCode, Err: r.err})
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package crawler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCrawlerCheckExternal(t *testing.T) {
+	var lock sync.Mutex
+	requests := map[string]int{}
+	inFlight, maxInFlight := 0, 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requests[r.Method+" "+r.URL.Path]++
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		lock.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		defer func() {
+			lock.Lock()
+			inFlight--
+			lock.Unlock()
+		}()
+
+		switch r.URL.Path {
+		case "/nohead":
+			if r.Method == "HEAD" {
+				w.WriteHeader(405)
+			}
+		case "/moved":
+			http.Redirect(w, r, "/dead", 301)
+		case "/dead":
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	site := map[string][]string{
+		"/":     {"/page", ts.URL + "/ok", ts.URL + "/nohead", ts.URL + "/dead"},
+		"/page": {ts.URL + "/ok", ts.URL + "/moved", ts.URL + "/other"},
+	}
+	fetcher := func(p Page) []*url.URL {
+		return mapURLs(p.URL(), site[p.URL().Path])
+	}
+
+	c := NewCrawler(2, PageFetcherFunc(fetcher))
+	c.CheckExternal = true
+	c.CheckRequests = 2
+	cr, err := c.Crawl("http://testhost.local/")
+	assert.NoError(t, err)
+
+	lt := cr.LookupTable()
+	ok := lt[ts.URL+"/ok"]
+	assert.Equal(t, PageExternal.String(), ok.Status)
+	assert.Equal(t, 200, ok.StatusCode)
+	assert.Equal(t, "", ok.Error)
+	assert.Equal(t, 200, lt[ts.URL+"/nohead"].StatusCode, "GET is used if HEAD fails")
+	assert.Equal(t, 404, lt[ts.URL+"/dead"].StatusCode)
+	assert.Equal(t, "status code received: 404", lt[ts.URL+"/dead"].Error)
+	moved := lt[ts.URL+"/moved"]
+	assert.Equal(t, 404, moved.StatusCode, "redirects are followed")
+	assert.Equal(t, 1, len(moved.Redirects))
+
+	assert.Equal(t, 1, requests["HEAD /ok"], "each URL is checked once")
+	assert.Equal(t, 0, requests["GET /ok"])
+	assert.Equal(t, 1, requests["GET /nohead"])
+	assert.True(t, maxInFlight <= 2, "checks are limited to CheckRequests: %d", maxInFlight)
+}
+
+func TestCrawlerExternalUnchecked(t *testing.T) {
+	fetcher := func(p Page) []*url.URL {
+		if p.URL().Path == "/" {
+			return mapURLs(p.URL(), []string{"http://external.local/", "https://testhost.local/"})
+		}
+		return nil
+	}
+	c := NewCrawler(2, PageFetcherFunc(fetcher))
+	c.Scope = &Scope{HostMode: HostSameOrigin}
+	cr, err := c.Crawl("http://testhost.local/")
+	assert.NoError(t, err)
+
+	links := cr.Root().Links()
+	if assert.Equal(t, 2, len(links)) {
+		assert.Equal(t, PageExternal, links[0].Status())
+		assert.Equal(t, PageExternal, links[1].Status(), "another origin on the same host is external")
+		assert.NotEqual(t, cr.Root(), links[1])
+		assert.Equal(t, 0, links[0].StatusCode(), "links are not checked by default")
+	}
+}
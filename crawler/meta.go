@@ -0,0 +1,241 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// MetaField selects fields of PageMeta to be recorded. The fields are bit flags
+// that can be combined.
+type MetaField uint
+
+const (
+	MetaURL MetaField = 1 << iota
+	MetaContentType
+	MetaContentLength
+	MetaResponseTime
+	MetaLastModified
+	MetaETag
+	MetaTitle
+	MetaDescription
+	MetaCanonical
+	MetaLang
+	MetaH1
+	MetaWordCount
+	MetaAlternates
+
+	// MetaAll selects all of the fields.
+	MetaAll MetaField = 1<<iota - 1
+)
+
+var metaFieldNames = []string{
+	"url",
+	"type",
+	"length",
+	"time",
+	"lastmodified",
+	"etag",
+	"title",
+	"description",
+	"canonical",
+	"lang",
+	"h1",
+	"words",
+	"alternates",
+}
+
+// String returns the names of the fields, separated by commas.
+func (f MetaField) String() string {
+	var names []string
+	for i, name := range metaFieldNames {
+		if f&(1<<uint(i)) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// ParseMetaFields parses a comma separated list of field names as returned by
+// MetaField.String. "all" selects all fields, and "none" or the empty string
+// none of them.
+func ParseMetaFields(s string) (MetaField, error) {
+	var f MetaField
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case "", "none":
+			continue
+		case "all":
+			f |= MetaAll
+			continue
+		}
+		i := 0
+		for i < len(metaFieldNames) && metaFieldNames[i] != name {
+			i++
+		}
+		if i == len(metaFieldNames) {
+			return 0, fmt.Errorf("unknown metadata field: %q", name)
+		}
+		f |= 1 << uint(i)
+	}
+	return f, nil
+}
+
+// PageMeta is the metadata of a fetched page, from the response headers and the
+// HTML. Fields that were not found or not selected are left at their zero value.
+type PageMeta struct {
+	// URL is the final URL of the page, after any redirects.
+	URL *url.URL
+	// ContentType is that of the response header.
+	ContentType string
+	// ContentLength is from the response header, or is the length of the body
+	// read if the header has none. It is -1 if it is not known.
+	ContentLength int64
+	// ResponseTime is the time until the final response headers were received.
+	ResponseTime time.Duration
+	// LastModified and ETag are from the response headers.
+	LastModified time.Time
+	ETag         string
+
+	// Title is the text of the <title> element.
+	Title string
+	// Description is the content of the description meta tag.
+	Description string
+	// Canonical is the URL of the rel="canonical" link element.
+	Canonical *url.URL
+	// Lang is the lang attribute of the <html> element.
+	Lang string
+	// H1 is the text of each <h1> element.
+	H1 []string
+	// WordCount is the number of words in the text of the body, leaving out
+	// scripts and styles.
+	WordCount int
+	// Alternates are the versions of the page in other languages, from the
+	// rel="alternate" link elements with an hreflang.
+	Alternates []Alternate
+}
+
+// Alternate is a version of a page for another language or region.
+type Alternate struct {
+	// Lang is the hreflang, such as "de", "en-GB" or "x-default".
+	Lang string
+	URL  *url.URL
+}
+
+// only returns a copy of m with just the selected fields.
+func (m PageMeta) only(fields MetaField) PageMeta {
+	var r PageMeta
+	if fields&MetaURL != 0 {
+		r.URL = m.URL
+	}
+	if fields&MetaContentType != 0 {
+		r.ContentType = m.ContentType
+	}
+	if fields&MetaContentLength != 0 {
+		r.ContentLength = m.ContentLength
+	}
+	if fields&MetaResponseTime != 0 {
+		r.ResponseTime = m.ResponseTime
+	}
+	if fields&MetaLastModified != 0 {
+		r.LastModified = m.LastModified
+	}
+	if fields&MetaETag != 0 {
+		r.ETag = m.ETag
+	}
+	if fields&MetaTitle != 0 {
+		r.Title = m.Title
+	}
+	if fields&MetaDescription != 0 {
+		r.Description = m.Description
+	}
+	if fields&MetaCanonical != 0 {
+		r.Canonical = m.Canonical
+	}
+	if fields&MetaLang != 0 {
+		r.Lang = m.Lang
+	}
+	if fields&MetaH1 != 0 {
+		r.H1 = m.H1
+	}
+	if fields&MetaWordCount != 0 {
+		r.WordCount = m.WordCount
+	}
+	if fields&MetaAlternates != 0 {
+		r.Alternates = m.Alternates
+	}
+	return r
+}
+
+// responseMeta sets the fields of m that come from the final response.
+func responseMeta(m *PageMeta, res *http.Response, firstByte time.Duration) {
+	m.URL = res.Request.URL
+	m.ContentType = res.Header.Get("Content-Type")
+	m.ContentLength = res.ContentLength
+	m.ResponseTime = firstByte
+	if t, err := http.ParseTime(res.Header.Get("Last-Modified")); err == nil {
+		m.LastModified = t
+	}
+	m.ETag = res.Header.Get("ETag")
+}
+
+// htmlMeta sets the fields of m that come from the HTML of doc, with the
+// canonical URL resolved against base.
+func htmlMeta(m *PageMeta, doc *goquery.Document, base *url.URL) {
+	m.Title = collapseSpace(doc.Find("title").First().Text())
+	doc.Find("meta[name][content]").EachWithBreak(func(n int, s *goquery.Selection) bool {
+		if name, _ := s.Attr("name"); strings.EqualFold(name, "description") {
+			content, _ := s.Attr("content")
+			m.Description = collapseSpace(content)
+			return false
+		}
+		return true
+	})
+	doc.Find("link[rel][href]").Each(func(n int, s *goquery.Selection) {
+		rel := LinkInfo{Rel: relValues(s)}
+		href, _ := s.Attr("href")
+		switch {
+		case rel.HasRel("canonical") && m.Canonical == nil:
+			m.Canonical = resolveRef(base, href)
+		case rel.HasRel("alternate"):
+			lang, _ := s.Attr("hreflang")
+			if u := resolveRef(base, href); u != nil && strings.TrimSpace(lang) != "" {
+				m.Alternates = append(m.Alternates, Alternate{strings.TrimSpace(lang), u})
+			}
+		}
+	})
+	m.Lang, _ = doc.Find("html").First().Attr("lang")
+	doc.Find("h1").Each(func(n int, s *goquery.Selection) {
+		m.H1 = append(m.H1, collapseSpace(s.Text()))
+	})
+	for _, n := range doc.Find("body").Nodes {
+		m.WordCount += wordCount(n)
+	}
+}
+
+// collapseSpace trims s and replaces each run of white space with a single space.
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// wordCount counts the words of the text under n, leaving out elements that are
+// not displayed as text.
+func wordCount(n *html.Node) int {
+	switch {
+	case n.Type == html.TextNode:
+		return len(strings.Fields(n.Data))
+	case n.Type == html.ElementNode && (n.Data == "script" || n.Data == "style" || n.Data == "noscript" || n.Data == "template"):
+		return 0
+	}
+	count := 0
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		count += wordCount(c)
+	}
+	return count
+}
@@ -0,0 +1,98 @@
+package crawler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMetaFields(t *testing.T) {
+	f, err := ParseMetaFields("title, H1,words")
+	assert.NoError(t, err)
+	assert.Equal(t, MetaTitle|MetaH1|MetaWordCount, f)
+	assert.Equal(t, "title,h1,words", f.String())
+
+	f, err = ParseMetaFields("all")
+	assert.NoError(t, err)
+	assert.Equal(t, MetaAll, f)
+	assert.Equal(t, "url,type,length,time,lastmodified,etag,title,description,canonical,lang,h1,words,alternates", f.String())
+
+	f, err = ParseMetaFields("none")
+	assert.NoError(t, err)
+	assert.Equal(t, MetaField(0), f)
+
+	_, err = ParseMetaFields("title,size")
+	assert.Error(t, err)
+}
+
+func TestCrawlerMetadata(t *testing.T) {
+	modified := time.Date(2014, 6, 12, 20, 20, 58, 0, time.UTC)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			http.Redirect(w, r, "/home", 301)
+		case "/home":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+			w.Header().Set("ETag", `"abc"`)
+			w.Write([]byte(`<html lang="en-GB"><head>
+<title>
+  Home   page
+</title>
+<meta name="Description" content="All about the site">
+<link rel="canonical" href="/index">
+<link rel="alternate" hreflang="de" href="/de/home">
+<link rel="alternate" type="application/rss+xml" href="/feed">
+<script>var notWords = "a b c";</script>
+</head><body>
+<h1>Welcome <em>home</em></h1>
+<p>Three more words.</p><style>p { color: red }</style>
+<h1>Again</h1>
+</body></html>`))
+		}
+	}))
+	defer ts.Close()
+
+	c := NewCrawler(1, nil)
+	cr, err := c.Crawl(ts.URL + "/home")
+	assert.NoError(t, err)
+	assert.Equal(t, PageMeta{}, cr.Root().Meta(), "no metadata is recorded by default")
+
+	c.Metadata = MetaAll
+	cr, err = c.Crawl(ts.URL + "/")
+	assert.NoError(t, err)
+	home := cr.Root().Canonical()
+	m := home.Meta()
+	assert.Equal(t, ts.URL+"/home", m.URL.String())
+	assert.Equal(t, "text/html; charset=utf-8", m.ContentType)
+	assert.True(t, m.ContentLength > 300)
+	assert.True(t, m.ResponseTime > 0)
+	assert.Equal(t, modified, m.LastModified.UTC())
+	assert.Equal(t, `"abc"`, m.ETag)
+	assert.Equal(t, "Home page", m.Title)
+	assert.Equal(t, "All about the site", m.Description)
+	assert.Equal(t, ts.URL+"/index", m.Canonical.String())
+	assert.Equal(t, "en-GB", m.Lang)
+	assert.Equal(t, []string{"Welcome home", "Again"}, m.H1)
+	assert.Equal(t, 6, m.WordCount)
+	if assert.Equal(t, 1, len(m.Alternates)) {
+		assert.Equal(t, "de", m.Alternates[0].Lang)
+		assert.Equal(t, ts.URL+"/de/home", m.Alternates[0].URL.String())
+	}
+
+	pr := cr.LookupTable()[ts.URL+"/home"]
+	assert.Equal(t, ts.URL+"/home", pr.FinalURL)
+	assert.Equal(t, "2014-06-12T20:20:58Z", pr.LastModified)
+	assert.Equal(t, "Home page", pr.Title)
+	assert.Equal(t, 6, pr.WordCount)
+	assert.Equal(t, []AlternateRecord{{"de", ts.URL + "/de/home"}}, pr.Alternates)
+	assert.True(t, pr.ResponseTime > 0)
+
+	c.Metadata = MetaTitle | MetaLang
+	cr, err = c.Crawl(ts.URL + "/home")
+	assert.NoError(t, err)
+	assert.Equal(t, PageMeta{Title: "Home page", Lang: "en-GB"}, cr.Root().Meta())
+}
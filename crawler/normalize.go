@@ -0,0 +1,178 @@
+package crawler
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Normalizer maps the URLs that name the same page to a single URL, which is the
+// identity of the page in the crawl.
+type Normalizer interface {
+	// Normalize returns the normalized form of u. It must not modify u.
+	Normalize(u *url.URL) *url.URL
+}
+
+// NormalizerFunc is an adapter to allow the use of ordinary functions as a Normalizer.
+type NormalizerFunc func(u *url.URL) *url.URL
+
+// Normalize calls f(u).
+func (f NormalizerFunc) Normalize(u *url.URL) *url.URL {
+	return f(u)
+}
+
+// URLNormalizer is the standard Normalizer. It always applies the RFC 3986
+// normalizations that do not change what a URL refers to: the host is lower
+// cased, default ports are removed, percent-encodings are upper cased or decoded
+// if they need not be encoded, dot segments are removed and an empty path
+// becomes "/". The other normalizations are optional.
+type URLNormalizer struct {
+	// LowerCasePath lower cases the path, for servers that ignore its case.
+	LowerCasePath bool
+	// IndexNames are file names, such as "index.html", removed from the end of
+	// the path so that a directory and its index page are the same page.
+	IndexNames []string
+	// TrimTrailingSlash removes a trailing slash from the path, other than the
+	// root path, so that /a and /a/ are the same page.
+	TrimTrailingSlash bool
+	// SortQuery sorts the query parameters by name, keeping the order of
+	// parameters with the same name.
+	SortQuery bool
+	// DropParams are query parameters that are removed, such as tracking
+	// parameters. A name ending in "*" matches all parameters starting with the
+	// rest of the name, as in "utm_*".
+	DropParams []string
+	// Scheme, if set, replaces the scheme of http and https URLs, so that a page
+	// is the same on both schemes.
+	Scheme string
+}
+
+// DefaultNormalizer is the Normalizer used by a Crawler without one. It only
+// applies the RFC 3986 normalizations.
+var DefaultNormalizer Normalizer = &URLNormalizer{}
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// Normalize returns the normalized copy of u.
+func (n *URLNormalizer) Normalize(u *url.URL) *url.URL {
+	nu := *u
+	nu.Host = strings.ToLower(nu.Host)
+	if port := nu.Port(); port != "" && port == defaultPorts[nu.Scheme] {
+		nu.Host = strings.TrimSuffix(nu.Host, ":"+port)
+	}
+	if n.Scheme != "" && (nu.Scheme == "http" || nu.Scheme == "https") {
+		nu.Scheme = n.Scheme
+	}
+
+	if nu.Opaque == "" {
+		p := nu.EscapedPath()
+		if n.LowerCasePath {
+			p = strings.ToLower(p)
+		}
+		p = removeDotSegments(normalizeEscapes(p))
+		if p == "" && nu.Host != "" {
+			p = "/"
+		}
+		for _, index := range n.IndexNames {
+			if strings.HasSuffix(p, "/"+index) {
+				p = p[:len(p)-len(index)]
+				break
+			}
+		}
+		if n.TrimTrailingSlash && len(p) > 1 {
+			p = strings.TrimRight(p, "/")
+			if p == "" {
+				p = "/"
+			}
+		}
+		if up, err := url.PathUnescape(p); err == nil {
+			nu.Path, nu.RawPath = up, ""
+			// the raw path is only kept where it differs from the default encoding
+			if nu.EscapedPath() != p {
+				nu.RawPath = p
+			}
+		}
+	}
+
+	q := stripParams(&nu, n.DropParams).RawQuery
+	if n.SortQuery && q != "" {
+		params := strings.Split(q, "&")
+		sort.SliceStable(params, func(i, j int) bool {
+			return paramName(params[i]) < paramName(params[j])
+		})
+		q = strings.Join(params, "&")
+	}
+	nu.RawQuery = normalizeEscapes(q)
+	if nu.RawQuery == "" {
+		nu.ForceQuery = false
+	}
+	return &nu
+}
+
+// isUnreserved reports whether c is an unreserved character of RFC 3986, which
+// never needs to be percent-encoded.
+func isUnreserved(c byte) bool {
+	return 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+// normalizeEscapes decodes the percent-encoded unreserved characters of s and
+// upper cases the hexadecimal digits of the other encodings.
+func normalizeEscapes(s string) string {
+	if strings.IndexByte(s, '%') < 0 {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+2 >= len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		hex := strings.ToUpper(s[i+1 : i+3])
+		c, err := url.PathUnescape("%" + hex)
+		switch {
+		case err != nil:
+			b.WriteByte(s[i])
+			continue
+		case isUnreserved(c[0]):
+			b.WriteString(c)
+		default:
+			b.WriteString("%" + hex)
+		}
+		i += 2
+	}
+	return b.String()
+}
+
+// removeDotSegments removes the "." and ".." segments of an absolute path, as in
+// RFC 3986 section 5.2.4. Unlike path.Clean, empty segments and a trailing slash
+// are kept.
+func removeDotSegments(p string) string {
+	if !strings.Contains(p, ".") || !strings.HasPrefix(p, "/") {
+		return p
+	}
+	segments := strings.Split(p[1:], "/")
+	out := make([]string, 0, len(segments))
+	for i, s := range segments {
+		last := i == len(segments)-1
+		switch s {
+		case ".":
+			if last {
+				out = append(out, "")
+			}
+		case "..":
+			if len(out) > 0 {
+				out = out[:len(out)-1]
+			}
+			if last {
+				out = append(out, "")
+			}
+		default:
+			out = append(out, s)
+		}
+	}
+	return "/" + strings.Join(out, "/")
+}
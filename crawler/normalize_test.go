@@ -0,0 +1,104 @@
+package crawler
+
+import (
+	"net/url"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestURLNormalizer(t *testing.T) {
+	all := &URLNormalizer{
+		LowerCasePath: true,
+		IndexNames:    []string{"index.html", "default.aspx"},
+		SortQuery:     true,
+		DropParams:    []string{"utm_*", "gclid"},
+		Scheme:        "https",
+	}
+	tests := []struct {
+		n        Normalizer
+		raw, out string
+	}{
+		{DefaultNormalizer, "HTTP://Example.COM", "http://example.com/"},
+		{DefaultNormalizer, "http://example.com:80/a", "http://example.com/a"},
+		{DefaultNormalizer, "https://example.com:443/a", "https://example.com/a"},
+		{DefaultNormalizer, "http://example.com:8080/a", "http://example.com:8080/a"},
+		{DefaultNormalizer, "http://example.com/%7euser/%2fx%3f", "http://example.com/~user/%2Fx%3F"},
+		{DefaultNormalizer, "http://example.com/a/./b/../c/", "http://example.com/a/c/"},
+		{DefaultNormalizer, "http://example.com/a/..", "http://example.com/"},
+		{DefaultNormalizer, "http://example.com/Docs/index.html?b=1&a=%7e", "http://example.com/Docs/index.html?b=1&a=~"},
+		{DefaultNormalizer, "http://example.com/a#top", "http://example.com/a#top"},
+		{all, "http://example.com/Docs/Index.html", "https://example.com/docs/"},
+		{all, "http://example.com/Default.aspx?b=2&utm_source=x&a=1&b=1&gclid=3", "https://example.com/?a=1&b=2&b=1"},
+		{all, "http://example.com/a?utm_source=x", "https://example.com/a"},
+		{all, "ftp://example.com/a", "ftp://example.com/a"},
+		{&URLNormalizer{TrimTrailingSlash: true}, "http://example.com/a/", "http://example.com/a"},
+		{&URLNormalizer{TrimTrailingSlash: true}, "http://example.com/a//?b=1", "http://example.com/a?b=1"},
+		{&URLNormalizer{TrimTrailingSlash: true}, "http://example.com/", "http://example.com/"},
+		{&URLNormalizer{TrimTrailingSlash: true, IndexNames: []string{"index.html"}}, "http://example.com/a/index.html", "http://example.com/a"},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.raw)
+		assert.NoError(t, err)
+		before := u.String()
+		assert.Equal(t, tt.out, tt.n.Normalize(u).String(), tt.raw)
+		assert.Equal(t, before, u.String(), "the URL is not modified")
+	}
+}
+
+func TestCrawlerNormalizer(t *testing.T) {
+	fetcher := func(p Page) []*url.URL {
+		if p.URL().Path == "/" {
+			return mapURLs(p.URL(), []string{"/index.html", "/Docs/", "/docs/?utm_medium=x", "https://testhost.local/docs/", "http://TESTHOST.local:80/about"})
+		}
+		return nil
+	}
+
+	c := NewCrawler(2, PageFetcherFunc(fetcher))
+	cr, err := c.Crawl("http://testhost.local")
+	assert.NoError(t, err)
+	var urls []string
+	for k := range cr.LookupTable() {
+		urls = append(urls, k)
+	}
+	sort.Strings(urls)
+	assert.Equal(t, []string{
+		"http://testhost.local/",
+		"http://testhost.local/Docs/",
+		"http://testhost.local/about",
+		"http://testhost.local/docs/?utm_medium=x",
+		"http://testhost.local/index.html",
+		"https://testhost.local/docs/",
+	}, urls, "only RFC 3986 normalization by default")
+
+	c.Normalizer = &URLNormalizer{LowerCasePath: true, IndexNames: []string{"index.html"}, DropParams: []string{"utm_*"}, Scheme: "http"}
+	cr, err = c.Crawl("http://testhost.local")
+	assert.NoError(t, err)
+	lt := cr.LookupTable()
+	assert.Equal(t, 3, len(lt))
+	assert.Equal(t, []string{
+		"http://testhost.local/",
+		"http://testhost.local/docs/",
+		"http://testhost.local/docs/",
+		"http://testhost.local/docs/",
+		"http://testhost.local/about",
+	}, lt["http://testhost.local/"].Links)
+}
+
+func TestCrawlerNormalizerTrailingSlash(t *testing.T) {
+	fetcher := func(p Page) []*url.URL {
+		if p.URL().Path == "/" {
+			return mapURLs(p.URL(), []string{"/a", "/a/"})
+		}
+		return nil
+	}
+
+	c := NewCrawler(2, PageFetcherFunc(fetcher))
+	c.Normalizer = &URLNormalizer{TrimTrailingSlash: true}
+	cr, err := c.Crawl("http://testhost.local/")
+	assert.NoError(t, err)
+	lt := cr.LookupTable()
+	assert.Equal(t, 2, len(lt), "/a and /a/ are one page")
+	assert.Equal(t, []string{"http://testhost.local/a", "http://testhost.local/a"}, lt["http://testhost.local/"].Links)
+}
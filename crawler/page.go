@@ -2,37 +2,167 @@ package crawler
 
 import (
 	"net/url"
+	"strings"
 )
 
+// PageStatus describes how far the crawler got with a page.
+type PageStatus int
+
+const (
+	// PageUnfetched is a page that was discovered but never fetched, either because
+	// it is beyond the crawl limits, is only linked with nofollow, or because the
+	// crawl was cancelled first.
+	PageUnfetched PageStatus = iota
+	// PageFetched is a page the fetcher ran to completion on. The fetch may still
+	// have failed, see Page.Error.
+	PageFetched
+	// PageCancelled is a page whose fetch was aborted because the crawl was cancelled.
+	PageCancelled
+	// PageBlocked is a page that was not fetched because robots.txt disallows it.
+	PageBlocked
+	// PageRedirect is a page that redirected to another page, see Page.Canonical.
+	PageRedirect
+	// PageOutOfScope is a page that was not fetched because it is outside the
+	// crawl Scope.
+	PageOutOfScope
+	// PageExternal is a page on a host that is not crawled. It is only fetched
+	// if external links are checked, see Crawler.CheckExternal.
+	PageExternal
+)
+
+var pageStatusNames = []string{
+	PageUnfetched:  "unfetched",
+	PageFetched:    "fetched",
+	PageCancelled:  "cancelled",
+	PageBlocked:    "blocked by robots",
+	PageRedirect:   "redirect",
+	PageOutOfScope: "out of scope",
+	PageExternal:   "external",
+}
+
+func (s PageStatus) String() string {
+	if s < 0 || int(s) >= len(pageStatusNames) {
+		return "unknown"
+	}
+	return pageStatusNames[s]
+}
+
+// Redirect is a single server-side redirect hop.
+type Redirect struct {
+	// StatusCode is the HTTP status of the redirect response.
+	StatusCode int
+	// URL is the resolved Location the response redirected to.
+	URL *url.URL
+}
+
+// Edge is a link from a page to the linked Page.
+type Edge struct {
+	Page Page
+	LinkInfo
+}
+
+// BrokenAnchor reports whether the link has a fragment that is not an anchor of
+// the linked page, following a redirect to a crawled page. It is false if the
+// page was not fetched successfully, so lazy pages are not fetched for it.
+func (e Edge) BrokenAnchor() bool {
+	// the top of the page needs no anchor, and text fragments are not anchors
+	if e.Fragment == "" || strings.EqualFold(e.Fragment, "top") || strings.HasPrefix(e.Fragment, ":~:") {
+		return false
+	}
+	p := e.Page
+	if p.Status() == PageRedirect && p.Canonical() != nil {
+		p = p.Canonical()
+	}
+	if p.Status() != PageFetched || p.Error() != nil {
+		return false
+	}
+	return !p.HasAnchor(e.Fragment)
+}
+
 // Page is a single node in a site map (graph).
-// XXX: Fetchers should have a separate interface or struct for their half
 type Page interface {
 	// URL is the URL that was used to fetch the page.
-	// Any server-side redirect information will not be preserved.
+	// Any server-side redirects are available from Redirects.
 	URL() *url.URL
 
+	// Redirects returns the chain of redirects followed when fetching the page.
+	Redirects() []Redirect
+	// Canonical returns the page this page redirects to, or nil if it is not
+	// a redirect. A target outside the crawl is an external or out of scope page.
+	Canonical() Page
+	// Aliases returns the URLs of pages that redirect to this page.
+	Aliases() []*url.URL
+
 	// Error is any error that occurred while fetching the page data.
 	Error() error
 
+	// StatusCode is the HTTP status code of the final response for the page, or
+	// zero if there was none.
+	StatusCode() int
+
+	// Status reports whether the page was fetched.
+	Status() PageStatus
+
+	// Attempts is the number of times the page was fetched, more than one if
+	// failed fetches were retried.
+	Attempts() int
+
+	// Depth is the number of links on the shortest path found from the root to the page.
+	Depth() int
+
 	// Assets returns the collection of assets associated with the page.
 	Assets() []Asset
 
-	// Links returns all the resolved linked pages
+	// Links returns all the resolved linked pages. For a lazy page this fetches
+	// the page first.
 	Links() []Page
 	// GenerateLinks provides a generator for linked pages.
 	GenerateLinks() <-chan Page
+	// Edges returns the links with what is known about their elements, in the
+	// same order as Links.
+	Edges() []Edge
+	// NoIndex reports whether the page asked not to be indexed, if the crawler
+	// respects robots meta tags.
+	NoIndex() bool
+	// Meta returns the metadata fields of the page selected by Crawler.Metadata.
+	Meta() PageMeta
+	// HasAnchor reports whether the page has an element with the id or anchor
+	// name, which a URL fragment can refer to.
+	HasAnchor(name string) bool
 
-	// fetcher functions
+	// setters for PageFetcherFunc fetchers
 	SetAssets(assets []Asset)
 	SetError(err error)
+	SetRedirects(redirects []Redirect)
 }
 
 // page is a basic non-lazy (eager) loaded page in the graph
 type page struct {
 	url    *url.URL
 	err    error
-	linked []Page
-	assets []Asset
+	status PageStatus
+	depth  int
+	// statusCode is only known for pages fetched with the crawler
+	statusCode int
+	queued     bool
+	// attempts is the number of fetches, counting retries
+	attempts int
+	linked   []Page
+	// nofollow is whether each linked page is only linked with nofollow
+	nofollow []bool
+	// linkInfo is in the same order as linked
+	linkInfo []LinkInfo
+	assets   []Asset
+	noIndex  bool
+	meta     PageMeta
+	anchors  map[string]bool
+
+	redirects []Redirect
+	canonical *page
+	aliases   []*url.URL
+
+	// lazy is set for pages that are fetched on first use
+	lazy *lazyLoader
 }
 
 // newEagerPage creates a new page with empty links and assets.
@@ -52,19 +182,65 @@ func (p *page) URL() *url.URL {
 	return p.url
 }
 
+func (p *page) Redirects() []Redirect {
+	defer p.lockState()()
+	return p.redirects
+}
+
+func (p *page) SetRedirects(redirects []Redirect) {
+	defer p.lockState()()
+	p.redirects = redirects
+}
+
+func (p *page) Canonical() Page {
+	defer p.lockState()()
+	if p.canonical == nil {
+		return nil
+	}
+	return p.canonical
+}
+
+func (p *page) Aliases() []*url.URL {
+	defer p.lockState()()
+	return p.aliases
+}
+
 func (p *page) Error() error {
+	p.load()
 	return p.err
 }
 
+func (p *page) StatusCode() int {
+	p.load()
+	return p.statusCode
+}
+
+func (p *page) Status() PageStatus {
+	defer p.lockState()()
+	return p.status
+}
+
+func (p *page) Attempts() int {
+	defer p.lockState()()
+	return p.attempts
+}
+
+func (p *page) Depth() int {
+	defer p.lockState()()
+	return p.depth
+}
+
 func (p *page) SetError(err error) {
 	p.err = err
 }
 
 func (p *page) Links() []Page {
+	p.load()
 	return ([]Page)(p.linked)
 }
 
 func (p *page) GenerateLinks() <-chan Page {
+	p.load()
 	pages := make(chan Page, 32)
 	go func() {
 		for _, v := range p.linked {
@@ -75,7 +251,35 @@ func (p *page) GenerateLinks() <-chan Page {
 	return pages
 }
 
+func (p *page) Edges() []Edge {
+	p.load()
+	edges := make([]Edge, len(p.linked))
+	for i, lp := range p.linked {
+		edges[i].Page = lp
+		if i < len(p.linkInfo) {
+			edges[i].LinkInfo = p.linkInfo[i]
+		}
+	}
+	return edges
+}
+
+func (p *page) NoIndex() bool {
+	p.load()
+	return p.noIndex
+}
+
+func (p *page) Meta() PageMeta {
+	p.load()
+	return p.meta
+}
+
+func (p *page) HasAnchor(name string) bool {
+	p.load()
+	return p.anchors[name]
+}
+
 func (p *page) Assets() []Asset {
+	p.load()
 	return p.assets
 }
 
@@ -0,0 +1,186 @@
+package crawler
+
+import (
+	"math"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// minAdaptiveDelay is the smallest delay the adaptive mode adds, smaller delays
+	// are dropped once responses recover.
+	minAdaptiveDelay = 100 * time.Millisecond
+	// maxAdaptiveDelay caps the delay the adaptive mode adds between requests.
+	maxAdaptiveDelay = 30 * time.Second
+)
+
+// RateLimit throttles the requests made to each crawled host, on top of the
+// limit on simultaneous requests. The zero value does not limit anything.
+type RateLimit struct {
+	// Rate is the sustained number of requests per second. Zero means no limit.
+	Rate float64
+	// Burst is the number of requests that may start at once before Rate applies.
+	// Values below 1 mean 1.
+	Burst int
+	// Delay is the minimum time between the start of two requests. A longer
+	// robots.txt Crawl-delay is used instead when robots.txt is respected.
+	Delay time.Duration
+	// Adaptive adds to the delay between requests when the server answers 429 or
+	// its response times rise well above the fastest seen, and gradually takes
+	// it away again as responses recover.
+	Adaptive bool
+}
+
+// limiter is the token bucket and delay state of a RateLimit for one crawl.
+type limiter struct {
+	lock     sync.Mutex
+	interval time.Duration
+	burst    int
+	delay    time.Duration
+	adaptive bool
+
+	tokens float64
+	// last is when tokens was last brought up to date
+	last time.Time
+	// next is the earliest start of the next request because of the delays
+	next time.Time
+
+	// latency is a moving average of the response times and baseline its lowest
+	// value, backoff is the delay added by the adaptive mode
+	latency  time.Duration
+	baseline time.Duration
+	backoff  time.Duration
+}
+
+// newLimiter returns a limiter for rl with the given minimum delay between
+// requests, or nil if nothing is limited.
+func newLimiter(rl RateLimit, delay time.Duration) *limiter {
+	if rl.Rate <= 0 && delay <= 0 && !rl.Adaptive {
+		return nil
+	}
+	l := &limiter{
+		burst:    rl.Burst,
+		delay:    delay,
+		adaptive: rl.Adaptive,
+	}
+	if rl.Rate > 0 {
+		l.interval = time.Duration(float64(time.Second) / rl.Rate)
+	}
+	if l.burst < 1 {
+		l.burst = 1
+	}
+	l.tokens = float64(l.burst)
+	return l
+}
+
+// hostLimiters keeps a limiter for each host of a crawl, which also honours the
+// robots.txt Crawl-delay of the host.
+type hostLimiters struct {
+	rl     RateLimit
+	robots *robotsCache
+
+	lock  sync.Mutex
+	hosts map[string]*limiter
+}
+
+func newHostLimiters(rl RateLimit, robots *robotsCache) *hostLimiters {
+	return &hostLimiters{
+		rl:     rl,
+		robots: robots,
+		hosts:  make(map[string]*limiter),
+	}
+}
+
+// get returns the limiter for the host of u, or nil if it is not limited.
+func (hl *hostLimiters) get(u *url.URL) *limiter {
+	// robots.txt may need fetching, which is done without the lock
+	delay := hl.rl.Delay
+	if d := hl.robots.crawlDelay(u); d > delay {
+		delay = d
+	}
+
+	hl.lock.Lock()
+	defer hl.lock.Unlock()
+	l, ok := hl.hosts[u.Host]
+	if !ok {
+		l = newLimiter(hl.rl, delay)
+		hl.hosts[u.Host] = l
+	}
+	return l
+}
+
+// take starts a request at now if the limits allow it, and returns zero. Otherwise
+// nothing is taken and it returns how long to wait before trying again. The delays
+// count from when a request is taken, so a waiter that wakes up late does not bring
+// the next request any closer.
+func (l *limiter) take(now time.Time) time.Duration {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	wait := l.next.Sub(now)
+	if l.interval > 0 {
+		if !l.last.IsZero() {
+			l.tokens += float64(now.Sub(l.last)) / float64(l.interval)
+			if l.tokens > float64(l.burst) {
+				l.tokens = float64(l.burst)
+			}
+		}
+		l.last = now
+		if l.tokens < 1 {
+			if d := time.Duration(math.Ceil((1 - l.tokens) * float64(l.interval))); d > wait {
+				wait = d
+			}
+		}
+	}
+	if wait > 0 {
+		return wait
+	}
+	if l.interval > 0 {
+		l.tokens--
+	}
+	l.next = now.Add(l.delay + l.backoff)
+	return 0
+}
+
+// observe adjusts the adaptive delay to the outcome of a request.
+func (l *limiter) observe(r *FetchResult) {
+	if l == nil || !l.adaptive {
+		return
+	}
+	latency := r.FirstByte
+	if latency == 0 {
+		latency = r.Total
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if latency > 0 {
+		if l.latency == 0 {
+			l.latency = latency
+		} else {
+			l.latency = (4*l.latency + latency) / 5
+		}
+		if l.baseline == 0 || l.latency < l.baseline {
+			l.baseline = l.latency
+		}
+	}
+
+	switch {
+	case r.StatusCode == 429:
+		l.backoff *= 2
+		if l.backoff < time.Second {
+			l.backoff = time.Second
+		}
+	case l.latency > 2*l.baseline:
+		l.backoff += l.latency
+	default:
+		l.backoff -= l.backoff / 8
+		if l.backoff < minAdaptiveDelay {
+			l.backoff = 0
+		}
+	}
+	if l.backoff > maxAdaptiveDelay {
+		l.backoff = maxAdaptiveDelay
+	}
+}
@@ -0,0 +1,127 @@
+package crawler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiterTake(t *testing.T) {
+	now := time.Date(2014, 6, 12, 20, 0, 0, 0, time.UTC)
+	ms := func(d time.Duration) time.Duration {
+		return d / time.Millisecond
+	}
+	at := func(d time.Duration) time.Time {
+		return now.Add(d * time.Millisecond)
+	}
+
+	l := newLimiter(RateLimit{Rate: 10, Burst: 2}, 0)
+	assert.Equal(t, time.Duration(0), ms(l.take(now)), "the burst starts at once")
+	assert.Equal(t, time.Duration(0), ms(l.take(now)))
+	assert.Equal(t, time.Duration(100), ms(l.take(now)), "then the rate applies")
+	assert.Equal(t, time.Duration(100), ms(l.take(now)), "nothing is taken while waiting")
+	assert.Equal(t, time.Duration(0), ms(l.take(at(100))))
+	assert.Equal(t, time.Duration(100), ms(l.take(at(100))))
+	assert.Equal(t, time.Duration(0), ms(l.take(at(1000))))
+	assert.Equal(t, time.Duration(0), ms(l.take(at(1000))), "the burst refills")
+
+	l = newLimiter(RateLimit{}, 50*time.Millisecond)
+	assert.Equal(t, time.Duration(0), ms(l.take(now)))
+	assert.Equal(t, time.Duration(50), ms(l.take(now)), "the delay separates requests")
+	assert.Equal(t, time.Duration(0), ms(l.take(at(60))))
+	assert.Equal(t, time.Duration(10), ms(l.take(at(100))), "the delay counts from the late start")
+	assert.Equal(t, time.Duration(0), ms(l.take(at(500))))
+
+	assert.Nil(t, newLimiter(RateLimit{Burst: 5}, 0), "nothing is limited")
+}
+
+func TestLimiterAdaptive(t *testing.T) {
+	l := newLimiter(RateLimit{Adaptive: true}, 0)
+	fast := &FetchResult{StatusCode: 200, Timings: Timings{FirstByte: 10 * time.Millisecond}}
+	slow := &FetchResult{StatusCode: 200, Timings: Timings{FirstByte: 500 * time.Millisecond}}
+	limited := &FetchResult{StatusCode: 429, Timings: Timings{FirstByte: 10 * time.Millisecond}}
+
+	l.observe(fast)
+	assert.Equal(t, time.Duration(0), l.backoff)
+	l.observe(limited)
+	assert.Equal(t, time.Second, l.backoff, "429 slows down")
+	l.observe(limited)
+	assert.Equal(t, 2*time.Second, l.backoff)
+	for i := 0; i < 50; i++ {
+		l.observe(fast)
+	}
+	assert.Equal(t, time.Duration(0), l.backoff, "recovers as responses are fine")
+
+	l.observe(slow)
+	assert.True(t, l.backoff > 0, "rising latency slows down")
+	before := l.backoff
+	l.observe(slow)
+	assert.True(t, l.backoff > before)
+
+	now := time.Now()
+	l.take(now)
+	assert.Equal(t, l.backoff, l.take(now), "the backoff separates requests")
+
+	l.backoff = maxAdaptiveDelay
+	l.observe(limited)
+	assert.Equal(t, maxAdaptiveDelay, l.backoff, "the backoff is capped")
+}
+
+// fetchTimes records when each page was fetched.
+type fetchTimes struct {
+	lock  sync.Mutex
+	times []time.Time
+}
+
+func (ft *fetchTimes) fetcher(p Page) []*url.URL {
+	ft.lock.Lock()
+	ft.times = append(ft.times, time.Now())
+	ft.lock.Unlock()
+	return mapURLs(p.URL(), pages[p.URL().RequestURI()])
+}
+
+// minGap returns the shortest time between two fetches.
+func (ft *fetchTimes) minGap() time.Duration {
+	sort.Slice(ft.times, func(i, j int) bool { return ft.times[i].Before(ft.times[j]) })
+	gap := time.Duration(-1)
+	for i := 1; i < len(ft.times); i++ {
+		if d := ft.times[i].Sub(ft.times[i-1]); gap < 0 || d < gap {
+			gap = d
+		}
+	}
+	return gap
+}
+
+func TestCrawlerRateLimit(t *testing.T) {
+	var ft fetchTimes
+	c := NewCrawler(4, PageFetcherFunc(ft.fetcher))
+	c.MaxPages = 5
+	c.RateLimit = RateLimit{Delay: 20 * time.Millisecond}
+	_, err := c.Crawl("http://testhost.local/")
+	assert.NoError(t, err)
+	assert.Equal(t, 5, len(ft.times))
+	assert.True(t, ft.minGap() >= 20*time.Millisecond, "fetches are spread out: %v", ft.minGap())
+}
+
+func TestCrawlerCrawlDelay(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("User-agent: *\nCrawl-delay: 0.03\n"))
+	}))
+	defer ts.Close()
+
+	var ft fetchTimes
+	c := NewCrawler(4, PageFetcherFunc(ft.fetcher))
+	c.MaxPages = 5
+	c.RespectRobots = true
+	c.RateLimit = RateLimit{Delay: 10 * time.Millisecond}
+	_, err := c.Crawl(ts.URL + "/")
+	assert.NoError(t, err)
+	assert.Equal(t, 5, len(ft.times))
+	assert.True(t, ft.minGap() >= 30*time.Millisecond, "the longer Crawl-delay applies: %v", ft.minGap())
+}
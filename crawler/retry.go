@@ -0,0 +1,76 @@
+package crawler
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy decides when failed fetches are tried again. Timeouts, temporary
+// network errors, connection resets and the status codes 429, 502, 503 and 504 are
+// retried.
+type RetryPolicy struct {
+	// Attempts is the maximum number of attempts, including the first. Values
+	// below 2 disable retries.
+	Attempts int
+	// BaseDelay is the delay before the first retry, and is doubled for each
+	// further retry. A random jitter of up to half the delay is taken off.
+	BaseDelay time.Duration
+	// MaxDelay caps the delay before a retry, including one requested by a
+	// Retry-After header. Zero means no cap.
+	MaxDelay time.Duration
+}
+
+// retryable reports whether a fetch failed in a way that may succeed if repeated.
+func retryable(r *FetchResult) bool {
+	switch r.StatusCode {
+	case 429, 502, 503, 504:
+		return true
+	case 0:
+		// errors such as unknown hosts, bad certificates and malformed URLs persist
+		var ne net.Error
+		if errors.As(r.Err, &ne) && (ne.Timeout() || ne.Temporary()) {
+			return true
+		}
+		return errors.Is(r.Err, syscall.ECONNRESET)
+	}
+	return false
+}
+
+// delay returns how long to wait before retrying a fetch after the given attempt,
+// and whether it should be retried at all.
+func (rp RetryPolicy) delay(attempt int, r *FetchResult) (time.Duration, bool) {
+	if attempt >= rp.Attempts || r.Err == nil || !retryable(r) {
+		return 0, false
+	}
+	d := rp.BaseDelay << uint(attempt-1)
+	if d > 0 {
+		d -= time.Duration(rand.Int63n(int64(d/2) + 1))
+	}
+	if ra := retryAfter(r.Header, time.Now()); ra > d {
+		d = ra
+	}
+	if rp.MaxDelay > 0 && d > rp.MaxDelay {
+		d = rp.MaxDelay
+	}
+	return d, true
+}
+
+// retryAfter parses a Retry-After header, given either in seconds or as an HTTP date.
+func retryAfter(h http.Header, now time.Time) time.Duration {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,107 @@
+package crawler
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	rp := RetryPolicy{Attempts: 4, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	unavailable := &FetchResult{StatusCode: 503, Err: errors.New("non 200 status code received: 503")}
+
+	for attempt, max := range []time.Duration{100, 200, 400} {
+		d, retry := rp.delay(attempt+1, unavailable)
+		assert.True(t, retry)
+		assert.True(t, d <= max*time.Millisecond && d >= max*time.Millisecond/2, "backoff is exponential with jitter: %v", d)
+	}
+	_, retry := rp.delay(4, unavailable)
+	assert.False(t, retry, "attempts are limited")
+
+	_, retry = rp.delay(1, &FetchResult{StatusCode: 404, Err: errors.New("non 200 status code received: 404")})
+	assert.False(t, retry, "permanent errors are not retried")
+	_, retry = rp.delay(1, &FetchResult{Err: urlError(&net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)})})
+	assert.True(t, retry, "network errors are retried")
+
+	limited := &FetchResult{StatusCode: 429, Err: errors.New("non 200 status code received: 429"), Header: http.Header{"Retry-After": {"30"}}}
+	d, retry := rp.delay(1, limited)
+	assert.True(t, retry)
+	assert.Equal(t, time.Second, d, "Retry-After is honoured up to the maximum delay")
+}
+
+func urlError(err error) error {
+	return &url.Error{Op: "Get", URL: "http://testhost.local/", Err: err}
+}
+
+func TestRetryable(t *testing.T) {
+	for _, tc := range []struct {
+		err       error
+		retryable bool
+	}{
+		{urlError(&net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}), true},
+		{urlError(&net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "i/o timeout", IsTimeout: true}}), true},
+		{urlError(context.DeadlineExceeded), true},
+		{urlError(&net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", IsNotFound: true}}), false},
+		{urlError(x509.UnknownAuthorityError{}), false},
+		{urlError(errors.New("unsupported protocol scheme \"gopher\"")), false},
+		{urlError(context.Canceled), false},
+	} {
+		assert.Equal(t, tc.retryable, retryable(&FetchResult{Err: tc.err}), "%v", tc.err)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2014, 6, 12, 20, 0, 0, 0, time.UTC)
+	assert.Equal(t, 5*time.Second, retryAfter(http.Header{"Retry-After": {"5"}}, now))
+	assert.Equal(t, 90*time.Second, retryAfter(http.Header{"Retry-After": {"Thu, 12 Jun 2014 20:01:30 GMT"}}, now))
+	assert.Equal(t, time.Duration(0), retryAfter(http.Header{"Retry-After": {"soon"}}, now))
+	assert.Equal(t, time.Duration(0), retryAfter(http.Header{}, now))
+}
+
+func TestCrawlerRetry(t *testing.T) {
+	site := map[string][]string{
+		"/":       {"/flaky", "/other"},
+		"/flaky":  {},
+		"/other":  {},
+		"/broken": {},
+	}
+	var lock sync.Mutex
+	var order []string
+	attempts := 0
+
+	fetcher := FetcherFunc(func(ctx context.Context, u *url.URL) *FetchResult {
+		lock.Lock()
+		defer lock.Unlock()
+		order = append(order, u.Path)
+		if u.Path == "/flaky" {
+			attempts++
+			if attempts < 3 {
+				return &FetchResult{URL: u, StatusCode: 503, Err: errors.New("non 200 status code received: 503")}
+			}
+		}
+		return &FetchResult{URL: u, StatusCode: 200, Links: mapURLs(u, site[u.Path])}
+	})
+
+	c := NewCrawler(1, fetcher)
+	c.Retry = RetryPolicy{Attempts: 3, BaseDelay: 20 * time.Millisecond}
+	cr, err := c.Crawl("http://testhost.local/")
+	assert.NoError(t, err)
+
+	lt := cr.LookupTable()
+	flaky := lt["http://testhost.local/flaky"]
+	assert.Equal(t, "", flaky.Error, "the page succeeds once retried")
+	assert.Equal(t, 3, flaky.Attempts)
+	assert.Equal(t, 0, lt["http://testhost.local/other"].Attempts, "single attempts are not recorded")
+	assert.Equal(t, []string{"/", "/flaky", "/other", "/flaky", "/flaky"}, order,
+		"other fetches proceed while a retry waits")
+}
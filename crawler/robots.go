@@ -0,0 +1,290 @@
+package crawler
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultUserAgent is the user agent used when none is configured.
+const DefaultUserAgent = "docrawl"
+
+// maxRobotsSize is the most of a robots.txt file that is parsed, as recommended by RFC 9309.
+const maxRobotsSize = 500 * 1024
+
+// Robots is a parsed robots.txt file.
+type Robots struct {
+	groups []*robotsGroup
+	// disallowAll is set when robots.txt could not be retrieved due to a server error.
+	disallowAll bool
+
+	// Sitemaps are the URLs of all Sitemap lines in the file.
+	Sitemaps []string
+}
+
+type robotsGroup struct {
+	agents     []string
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+// ParseRobots parses a robots.txt file. Unknown and malformed lines are ignored.
+func ParseRobots(r io.Reader) (*Robots, error) {
+	robots := &Robots{}
+	var group *robotsGroup
+	// consecutive user-agent lines start a single group
+	inAgents := false
+
+	scanner := bufio.NewScanner(io.LimitReader(r, maxRobotsSize))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		colon := strings.IndexByte(line, ':')
+		if colon < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:colon]))
+		value := strings.TrimSpace(line[colon+1:])
+
+		switch key {
+		case "user-agent":
+			if !inAgents {
+				group = &robotsGroup{}
+				robots.groups = append(robots.groups, group)
+			}
+			group.agents = append(group.agents, strings.ToLower(value))
+			inAgents = true
+			continue
+		case "allow", "disallow":
+			// an empty disallow matches nothing, and rules outside a group are invalid
+			if group != nil && value != "" {
+				group.rules = append(group.rules, robotsRule{allow: key == "allow", pattern: value})
+			}
+		case "crawl-delay":
+			if group != nil {
+				if secs, err := strconv.ParseFloat(value, 64); err == nil && secs >= 0 {
+					group.crawlDelay = time.Duration(secs * float64(time.Second))
+				}
+			}
+		case "sitemap":
+			if value != "" {
+				robots.Sitemaps = append(robots.Sitemaps, value)
+			}
+		}
+		inAgents = false
+	}
+	return robots, scanner.Err()
+}
+
+// FetchRobots retrieves and parses the robots.txt file for the host of u. A missing
+// robots.txt allows everything, while a server error disallows everything as the
+// host can not be assumed to want to be crawled.
+func FetchRobots(ctx context.Context, u *url.URL, agent string) (*Robots, error) {
+	return defaultHTTPFetcher.fetchRobots(ctx, u, agent)
+}
+
+// fetchRobots is FetchRobots with the client and headers of f. The agent is only
+// sent if f does not have its own user agent.
+func (f *httpFetcher) fetchRobots(ctx context.Context, u *url.URL, agent string) (*Robots, error) {
+	if f.opts.UserAgent == "" && agent != "" {
+		ff := *f
+		ff.opts.UserAgent = agent
+		f = &ff
+	}
+	// the fetches to the host wait for robots.txt, so it must not hang
+	ctx, cancel := f.withTimeout(ctx)
+	defer cancel()
+	ru := &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/robots.txt"}
+	res, _, err := f.get(ctx, ru)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		return ParseRobots(res.Body)
+	case res.StatusCode >= 400 && res.StatusCode < 500:
+		return &Robots{}, nil
+	default:
+		return &Robots{disallowAll: true}, fmt.Errorf("robots.txt status code received: %v", res.StatusCode)
+	}
+}
+
+// robotsCache fetches the robots.txt of each host of a crawl once, when it is
+// first needed. The nil cache allows everything.
+type robotsCache struct {
+	ctx     context.Context
+	fetcher *httpFetcher
+	agent   string
+
+	lock  sync.Mutex
+	hosts map[string]*robotsEntry
+}
+
+type robotsEntry struct {
+	once   sync.Once
+	robots *Robots
+}
+
+func newRobotsCache(ctx context.Context, fetcher *httpFetcher, agent string) *robotsCache {
+	return &robotsCache{
+		ctx:     ctx,
+		fetcher: fetcher,
+		agent:   agent,
+		hosts:   make(map[string]*robotsEntry),
+	}
+}
+
+// get returns the robots.txt rules for the host of u, fetching them if needed.
+// An unreachable robots.txt does not block the crawl.
+func (rc *robotsCache) get(u *url.URL) *Robots {
+	if rc == nil {
+		return nil
+	}
+	rc.lock.Lock()
+	e := rc.hosts[u.Host]
+	if e == nil {
+		e = &robotsEntry{}
+		rc.hosts[u.Host] = e
+	}
+	rc.lock.Unlock()
+
+	e.once.Do(func() {
+		e.robots, _ = rc.fetcher.fetchRobots(rc.ctx, u, rc.agent)
+	})
+	return e.robots
+}
+
+// allowed reports whether the agent of the cache may fetch u.
+func (rc *robotsCache) allowed(u *url.URL) bool {
+	if rc == nil {
+		return true
+	}
+	return rc.get(u).Allowed(rc.agent, u)
+}
+
+// crawlDelay returns the Crawl-delay of the host of u for the agent of the cache.
+func (rc *robotsCache) crawlDelay(u *url.URL) time.Duration {
+	if rc == nil {
+		return 0
+	}
+	return rc.get(u).CrawlDelay(rc.agent)
+}
+
+// agentToken extracts the product token of a user agent string, "docrawl" for
+// "docrawl/1.0 (+http://example.com)".
+func agentToken(agent string) string {
+	if i := strings.IndexAny(agent, "/ "); i >= 0 {
+		agent = agent[:i]
+	}
+	return strings.ToLower(agent)
+}
+
+// rules returns the rules of all groups matching the agent, or of the * groups
+// if there are none.
+func (r *Robots) rules(agent string) (rules []robotsRule, delay time.Duration) {
+	token := agentToken(agent)
+	if token == "" {
+		token = agentToken(DefaultUserAgent)
+	}
+	for _, name := range []string{token, "*"} {
+		found := false
+		for _, g := range r.groups {
+			for _, a := range g.agents {
+				if a == name {
+					found = true
+					rules = append(rules, g.rules...)
+					if g.crawlDelay > delay {
+						delay = g.crawlDelay
+					}
+					break
+				}
+			}
+		}
+		if found {
+			return
+		}
+	}
+	return nil, 0
+}
+
+// Allowed reports whether the agent may fetch u. The most specific (longest) matching
+// rule decides, with allow rules winning ties.
+func (r *Robots) Allowed(agent string, u *url.URL) bool {
+	if r == nil {
+		return true
+	}
+	path := u.RequestURI()
+	if path == "/robots.txt" {
+		return true
+	}
+	if r.disallowAll {
+		return false
+	}
+
+	rules, _ := r.rules(agent)
+	allowed, matchLen := true, -1
+	for _, rule := range rules {
+		if len(rule.pattern) < matchLen || !robotsMatch(rule.pattern, path) {
+			continue
+		}
+		if len(rule.pattern) > matchLen || rule.allow {
+			allowed, matchLen = rule.allow, len(rule.pattern)
+		}
+	}
+	return allowed
+}
+
+// CrawlDelay returns the Crawl-delay for the agent, or zero if there is none.
+func (r *Robots) CrawlDelay(agent string) time.Duration {
+	if r == nil {
+		return 0
+	}
+	_, delay := r.rules(agent)
+	return delay
+}
+
+// robotsMatch matches a robots.txt path pattern against a path. In the pattern
+// "*" matches any sequence of characters and a trailing "$" anchors the end of the path,
+// otherwise the pattern is a prefix match.
+func robotsMatch(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = pattern[:len(pattern)-1]
+	}
+	parts := strings.Split(pattern, "*")
+
+	// the first part is always a prefix, as there is no leading *
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	path = path[len(parts[0]):]
+	if len(parts) == 1 {
+		return !anchored || path == ""
+	}
+	for i, part := range parts[1:] {
+		if i == len(parts)-2 && anchored {
+			return strings.HasSuffix(path, part)
+		}
+		j := strings.Index(path, part)
+		if j < 0 {
+			return false
+		}
+		path = path[j+len(part):]
+	}
+	return true
+}
@@ -0,0 +1,166 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testRobots = `# comment
+User-agent: docrawl
+User-agent: otherbot
+Disallow: /private/
+Allow: /private/public.html
+Disallow: /*.pdf$
+Crawl-delay: 2.5
+
+User-agent: *
+Disallow: /
+Allow: /$
+Allow: /docs/
+
+Sitemap: http://testhost.local/sitemap.xml
+`
+
+func TestParseRobots(t *testing.T) {
+	r, err := ParseRobots(strings.NewReader(testRobots))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"http://testhost.local/sitemap.xml"}, r.Sitemaps)
+	assert.Equal(t, 2500*time.Millisecond, r.CrawlDelay("docrawl/1.0"))
+	assert.Equal(t, 2500*time.Millisecond, r.CrawlDelay("OtherBot"), "agents match case insensitively")
+	assert.Equal(t, time.Duration(0), r.CrawlDelay("anybot"))
+}
+
+func TestRobotsAllowed(t *testing.T) {
+	r, _ := ParseRobots(strings.NewReader(testRobots))
+
+	tests := []struct {
+		agent   string
+		path    string
+		allowed bool
+	}{
+		{"docrawl", "/", true},
+		{"docrawl", "/private/secret.html", false},
+		{"docrawl", "/private/public.html", true},
+		{"docrawl", "/files/a.pdf", false},
+		{"docrawl", "/files/a.pdf?download", true},
+		{"docrawl/1.0 (+http://example.com)", "/private/", false},
+		{"anybot", "/", true},
+		{"anybot", "/index.html", false},
+		{"anybot", "/docs/index.html", true},
+		{"anybot", "/robots.txt", true},
+	}
+	for _, tt := range tests {
+		u, _ := url.Parse("http://testhost.local" + tt.path)
+		assert.Equal(t, tt.allowed, r.Allowed(tt.agent, u), "%s %s", tt.agent, tt.path)
+	}
+
+	var none *Robots
+	u, _ := url.Parse("http://testhost.local/private/")
+	assert.True(t, none.Allowed("docrawl", u), "no robots.txt allows everything")
+}
+
+func TestRobotsMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{"/fish", "/fish.html", true},
+		{"/fish", "/Fish.html", false},
+		{"/fish$", "/fish", true},
+		{"/fish$", "/fish/", false},
+		{"/*.php", "/folder/filename.php?parameters", true},
+		{"/*.php$", "/filename.php?parameters", false},
+		{"/fish*.php", "/fishheads/catfish.php", true},
+		{"/fish*.php", "/Fish.PHP", false},
+		{"*", "/anything", true},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.match, robotsMatch(tt.pattern, tt.path), "%s %s", tt.pattern, tt.path)
+	}
+}
+
+func TestFetchRobotsTimeout(t *testing.T) {
+	done := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer ts.Close()
+	defer close(done)
+
+	u, _ := url.Parse(ts.URL + "/")
+	f := NewHTTPFetcher(nil, HTTPOptions{Timeout: 50 * time.Millisecond}).(*httpFetcher)
+	start := time.Now()
+	_, err := f.fetchRobots(context.Background(), u, "docrawl")
+	assert.Error(t, err, "a hung robots.txt times out")
+	assert.True(t, time.Since(start) < 5*time.Second)
+}
+
+func TestCrawlerRobots(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("User-agent: *\nDisallow: /page2.html\nDisallow: /page4.html\n"))
+	}))
+	defer ts.Close()
+
+	var numFetches uint32
+	fetcher := func(p Page) []*url.URL {
+		atomic.AddUint32(&numFetches, 1)
+		return mapURLs(p.URL(), pages[p.URL().RequestURI()])
+	}
+
+	c := NewCrawler(2, PageFetcherFunc(fetcher))
+	c.RespectRobots = true
+	cr, err := c.Crawl(ts.URL + "/")
+	assert.NoError(t, err)
+	assert.NotNil(t, cr.Robots())
+
+	lt := cr.LookupTable()
+	assert.Equal(t, uint32(3), numFetches, "disallowed pages are not fetched")
+	assert.Equal(t, PageBlocked.String(), lt[ts.URL+"/page2.html"].Status)
+	assert.Equal(t, PageBlocked.String(), lt[ts.URL+"/page4.html"].Status)
+	assert.Equal(t, "", lt[ts.URL+"/page3.html"].Status)
+}
+
+func TestCrawlerRobotsPerHost(t *testing.T) {
+	var robotsFetches uint32
+	robotsServer := func(robots string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddUint32(&robotsFetches, 1)
+			w.Write([]byte(robots))
+		}))
+	}
+	ts := robotsServer("User-agent: *\nDisallow: /private\n")
+	defer ts.Close()
+	other := robotsServer("User-agent: *\nDisallow: /\n")
+	defer other.Close()
+
+	fetcher := func(p Page) []*url.URL {
+		if p.URL().Host != other.Listener.Addr().String() {
+			return mapURLs(p.URL(), []string{"/private", other.URL + "/a", other.URL + "/b"})
+		}
+		return nil
+	}
+	c := NewCrawler(2, PageFetcherFunc(fetcher))
+	c.RespectRobots = true
+	c.Scope = &Scope{HostMode: HostAllowlist, Hosts: []string{other.Listener.Addr().String()}}
+	cr, err := c.Crawl(ts.URL + "/")
+	assert.NoError(t, err)
+
+	lt := cr.LookupTable()
+	assert.Equal(t, PageBlocked.String(), lt[ts.URL+"/private"].Status)
+	assert.Equal(t, PageBlocked.String(), lt[other.URL+"/a"].Status, "each host has its own robots.txt")
+	assert.Equal(t, PageBlocked.String(), lt[other.URL+"/b"].Status)
+	assert.Equal(t, uint32(2), robotsFetches, "robots.txt is fetched once per host")
+}
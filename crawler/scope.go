@@ -0,0 +1,262 @@
+package crawler
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// HostMode selects the hosts that a crawl covers, starting from the host of the
+// root URL.
+type HostMode int
+
+const (
+	// HostExact crawls only the host and port of the root URL, on any scheme.
+	HostExact HostMode = iota
+	// HostSubdomains crawls all hosts of the registrable domain of the root URL,
+	// so www.example.com and api.example.com for a root on docs.example.com. The
+	// port is not taken into account.
+	HostSubdomains
+	// HostAllowlist crawls the host of the root URL and the hosts in Scope.Hosts.
+	HostAllowlist
+	// HostSameOrigin crawls only the scheme, host and port of the root URL.
+	HostSameOrigin
+)
+
+// ScopeRule matches URLs for the include and exclude lists of a Scope.
+type ScopeRule interface {
+	Match(u *url.URL) bool
+}
+
+type prefixRule string
+
+func (r prefixRule) Match(u *url.URL) bool {
+	return strings.HasPrefix(u.Path, string(r))
+}
+
+type regexpRule struct {
+	re *regexp.Regexp
+	// uri matches the request URI rather than just the path
+	uri bool
+}
+
+func (r regexpRule) Match(u *url.URL) bool {
+	if r.uri {
+		return r.re.MatchString(u.RequestURI())
+	}
+	return r.re.MatchString(u.Path)
+}
+
+// PathPrefix returns a rule matching URLs whose path starts with prefix.
+func PathPrefix(prefix string) ScopeRule {
+	return prefixRule(prefix)
+}
+
+// Glob returns a rule matching URLs whose whole path matches pattern. In the
+// pattern "*" matches any sequence of characters other than "/", "**" matches
+// any sequence including "/" and "?" matches a single character other than "/".
+func Glob(pattern string) (ScopeRule, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	rs := []rune(pattern)
+	for i := 0; i < len(rs); i++ {
+		switch c := rs[i]; c {
+		case '*':
+			if i+1 < len(rs) && rs[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil, err
+	}
+	return regexpRule{re: re}, nil
+}
+
+// Regexp returns a rule matching URLs whose request URI, the path and query,
+// contains a match of the regular expression expr.
+func Regexp(expr string) (ScopeRule, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return regexpRule{re: re, uri: true}, nil
+}
+
+// ParseScopeRule parses a rule given as "glob:PATTERN" for Glob, "re:EXPR" for
+// Regexp, or otherwise as a path prefix.
+func ParseScopeRule(s string) (ScopeRule, error) {
+	switch {
+	case strings.HasPrefix(s, "glob:"):
+		return Glob(s[len("glob:"):])
+	case strings.HasPrefix(s, "re:"):
+		return Regexp(s[len("re:"):])
+	}
+	return PathPrefix(s), nil
+}
+
+// Scope limits the crawl to parts of the hosts. Links to pages outside the scope
+// are kept, with status PageOutOfScope, but the pages are not fetched. The root
+// of a crawl is always fetched. Links to hosts outside the HostMode are kept as
+// PageExternal pages.
+type Scope struct {
+	// HostMode selects the hosts that are crawled.
+	HostMode HostMode
+	// Hosts are the hosts crawled besides the host of the root URL with
+	// HostAllowlist. A host without a port matches any port. Case and the default
+	// port of the scheme are ignored, as they are for page URLs.
+	Hosts []string
+	// Include, if not empty, limits the crawl to URLs matching any of the rules.
+	Include []ScopeRule
+	// Exclude leaves out URLs matching any of the rules, even if included.
+	Exclude []ScopeRule
+	// StripParams are query parameters removed from all links before they are
+	// used, so that pages differing only in them are crawled once. A name
+	// ending in "*" matches all parameters starting with the rest of the name.
+	StripParams []string
+}
+
+// Allowed reports whether u is within the scope.
+func (s *Scope) Allowed(u *url.URL) bool {
+	if s == nil {
+		return true
+	}
+	if len(s.Include) > 0 && !matchAny(s.Include, u) {
+		return false
+	}
+	return !matchAny(s.Exclude, u)
+}
+
+func matchAny(rules []ScopeRule, u *url.URL) bool {
+	for _, r := range rules {
+		if r.Match(u) {
+			return true
+		}
+	}
+	return false
+}
+
+// strip returns u without the StripParams query parameters. The order of the
+// other parameters is kept, and u itself is returned if nothing is removed.
+func (s *Scope) strip(u *url.URL) *url.URL {
+	if s == nil {
+		return u
+	}
+	return stripParams(u, s.StripParams)
+}
+
+// stripParams returns u without the query parameters matching names, where a
+// name ending in "*" matches by prefix. The order of the other parameters is
+// kept, and u itself is returned if nothing is removed.
+func stripParams(u *url.URL, names []string) *url.URL {
+	if len(names) == 0 || u.RawQuery == "" {
+		return u
+	}
+	params := strings.Split(u.RawQuery, "&")
+	kept := params[:0:0]
+	for _, param := range params {
+		if !paramMatches(names, paramName(param)) {
+			kept = append(kept, param)
+		}
+	}
+	if len(kept) == len(params) {
+		return u
+	}
+	su := *u
+	su.RawQuery = strings.Join(kept, "&")
+	su.ForceQuery = false
+	return &su
+}
+
+// paramName returns the unescaped name of a name=value query parameter.
+func paramName(param string) string {
+	name := param
+	if i := strings.IndexByte(name, '='); i >= 0 {
+		name = name[:i]
+	}
+	if n, err := url.QueryUnescape(name); err == nil {
+		name = n
+	}
+	return name
+}
+
+func paramMatches(names []string, name string) bool {
+	for _, p := range names {
+		if strings.HasSuffix(p, "*") && strings.HasPrefix(name, p[:len(p)-1]) || name == p {
+			return true
+		}
+	}
+	return false
+}
+
+// hostMatcher returns a function reporting whether a URL is on a host covered by
+// the scope for a crawl from root.
+func (s *Scope) hostMatcher(root *url.URL) func(u *url.URL) bool {
+	mode := HostExact
+	if s != nil {
+		mode = s.HostMode
+	}
+	switch mode {
+	case HostSubdomains:
+		domain, err := publicsuffix.EffectiveTLDPlusOne(root.Hostname())
+		if err != nil {
+			// IP addresses and bare public suffixes have no subdomains
+			domain = root.Hostname()
+		}
+		return func(u *url.URL) bool {
+			h := u.Hostname()
+			return h == domain || strings.HasSuffix(h, "."+domain)
+		}
+	case HostAllowlist:
+		hosts := make([]string, len(s.Hosts))
+		for i, h := range s.Hosts {
+			hosts[i] = strings.ToLower(strings.TrimSpace(h))
+		}
+		return func(u *url.URL) bool {
+			if u.Host == root.Host {
+				return true
+			}
+			host, name := normalHost(u, u.Host), strings.ToLower(u.Hostname())
+			for _, h := range hosts {
+				if normalHost(u, h) == host || h == name {
+					return true
+				}
+			}
+			return false
+		}
+	case HostSameOrigin:
+		origin := urlOrigin(root)
+		return func(u *url.URL) bool {
+			return urlOrigin(u) == origin
+		}
+	}
+	return func(u *url.URL) bool {
+		return u.Host == root.Host
+	}
+}
+
+// urlOrigin returns the scheme, host and port of u, with the default port of
+// the scheme made explicit.
+func urlOrigin(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		switch u.Scheme {
+		case "http":
+			port = "80"
+		case "https":
+			port = "443"
+		}
+	}
+	return u.Scheme + "://" + strings.ToLower(u.Hostname()) + ":" + port
+}
@@ -0,0 +1,192 @@
+package crawler
+
+import (
+	"net/url"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScopeRules(t *testing.T) {
+	tests := []struct {
+		rule  string
+		uri   string
+		match bool
+	}{
+		{"/docs/v2/", "/docs/v2/intro.html", true},
+		{"/docs/v2/", "/docs/v1/intro.html", false},
+		{"/docs/v2/", "/docs/v2", false},
+		{"glob:/docs/*/index.html", "/docs/v2/index.html", true},
+		{"glob:/docs/*/index.html", "/docs/v2/api/index.html", false},
+		{"glob:/docs/**/index.html", "/docs/v2/api/index.html", true},
+		{"glob:/page?.html", "/page1.html", true},
+		{"glob:/page?.html", "/page10.html", false},
+		{"glob:/a+b(c).html", "/a+b(c).html", true},
+		{"glob:/docs/café/*", "/docs/caf%C3%A9/x", true},
+		{"glob:/docs/caf?/*", "/docs/caf%C3%A9/x", true},
+		{"glob:/search", "/search?q=docs", true},
+		{`re:^/search\?q=`, "/search?q=docs", true},
+		{`re:^/search\?q=`, "/search", false},
+		{`re:\.pdf$`, "/files/manual.pdf", true},
+	}
+	for _, tt := range tests {
+		r, err := ParseScopeRule(tt.rule)
+		assert.NoError(t, err)
+		u, _ := url.Parse("http://testhost.local" + tt.uri)
+		assert.Equal(t, tt.match, r.Match(u), "%s %s", tt.rule, tt.uri)
+	}
+
+	_, err := ParseScopeRule("re:(")
+	assert.Error(t, err)
+}
+
+func TestScopeAllowed(t *testing.T) {
+	allowed := func(s *Scope, uri string) bool {
+		u, _ := url.Parse("http://testhost.local" + uri)
+		return s.Allowed(u)
+	}
+	var s *Scope
+	assert.True(t, allowed(s, "/anything"))
+
+	s = &Scope{
+		Include: []ScopeRule{PathPrefix("/docs/v2/"), PathPrefix("/blog/")},
+		Exclude: []ScopeRule{PathPrefix("/docs/v2/old/")},
+	}
+	assert.True(t, allowed(s, "/docs/v2/intro.html"))
+	assert.True(t, allowed(s, "/blog/"))
+	assert.False(t, allowed(s, "/docs/v1/intro.html"))
+	assert.False(t, allowed(s, "/docs/v2/old/intro.html"), "exclude wins over include")
+
+	s = &Scope{Exclude: []ScopeRule{PathPrefix("/search")}}
+	assert.True(t, allowed(s, "/docs/"), "everything is included without include rules")
+	assert.False(t, allowed(s, "/search?q=docs"))
+}
+
+func TestScopeStrip(t *testing.T) {
+	s := &Scope{StripParams: []string{"sessionid", "utm_*"}}
+	tests := []struct {
+		in, out string
+	}{
+		{"/page.html", "/page.html"},
+		{"/page.html?sessionid=42", "/page.html"},
+		{"/page.html?b=2&sessionid=42&a=1", "/page.html?b=2&a=1"},
+		{"/page.html?utm_source=feed&utm_medium=rss&id=7", "/page.html?id=7"},
+		{"/page.html?session%69d=42", "/page.html"},
+		{"/page.html?sessionidx=1", "/page.html?sessionidx=1"},
+	}
+	for _, tt := range tests {
+		u, _ := url.Parse("http://testhost.local" + tt.in)
+		assert.Equal(t, "http://testhost.local"+tt.out, s.strip(u).String(), tt.in)
+	}
+}
+
+func TestCrawlerScope(t *testing.T) {
+	site := map[string][]string{
+		"/":                   {"/docs/v2/", "/docs/v1/", "/search?q=x"},
+		"/docs/v2/":           {"/docs/v2/a.html?sessionid=1", "/docs/v2/a.html?sessionid=2", "/search?q=y"},
+		"/docs/v2/a.html":     {"/docs/v2/old/b.html"},
+		"/docs/v2/old/b.html": {},
+	}
+	var fetched []string
+	fetcher := func(p Page) []*url.URL {
+		fetched = append(fetched, p.URL().RequestURI())
+		return mapURLs(p.URL(), site[p.URL().RequestURI()])
+	}
+
+	c := NewCrawler(1, PageFetcherFunc(fetcher))
+	c.Scope = &Scope{
+		Include:     []ScopeRule{PathPrefix("/docs/v2/")},
+		Exclude:     []ScopeRule{PathPrefix("/docs/v2/old/")},
+		StripParams: []string{"sessionid"},
+	}
+	cr, err := c.Crawl("http://testhost.local/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/", "/docs/v2/", "/docs/v2/a.html"}, fetched, "the root is always fetched")
+
+	lt := cr.LookupTable()
+	assert.Equal(t, PageOutOfScope.String(), lt["http://testhost.local/docs/v1/"].Status)
+	assert.Equal(t, PageOutOfScope.String(), lt["http://testhost.local/search?q=x"].Status)
+	assert.Equal(t, PageOutOfScope.String(), lt["http://testhost.local/docs/v2/old/b.html"].Status)
+	assert.Equal(t, []string{
+		"http://testhost.local/docs/v2/a.html",
+		"http://testhost.local/docs/v2/a.html",
+		"http://testhost.local/search?q=y",
+	}, lt["http://testhost.local/docs/v2/"].Links, "out of scope links are kept")
+}
+
+func TestScopeHostModes(t *testing.T) {
+	root, _ := url.Parse("http://docs.example.com/")
+	tests := []struct {
+		scope *Scope
+		url   string
+		match bool
+	}{
+		{nil, "https://docs.example.com/a", true},
+		{nil, "http://docs.example.com:8080/a", false},
+		{nil, "http://www.example.com/", false},
+		{&Scope{HostMode: HostSubdomains}, "http://www.example.com/", true},
+		{&Scope{HostMode: HostSubdomains}, "https://api.v2.example.com/", true},
+		{&Scope{HostMode: HostSubdomains}, "http://example.com/", true},
+		{&Scope{HostMode: HostSubdomains}, "http://badexample.com/", false},
+		{&Scope{HostMode: HostSubdomains}, "http://example.org/", false},
+		{&Scope{HostMode: HostAllowlist, Hosts: []string{"cdn.example.net", "localhost:8000"}}, "http://docs.example.com/", true},
+		{&Scope{HostMode: HostAllowlist, Hosts: []string{"cdn.example.net", "localhost:8000"}}, "http://cdn.example.net:81/", true},
+		{&Scope{HostMode: HostAllowlist, Hosts: []string{"cdn.example.net", "localhost:8000"}}, "http://localhost:8000/", true},
+		{&Scope{HostMode: HostAllowlist, Hosts: []string{"cdn.example.net", "localhost:8000"}}, "http://localhost:8001/", false},
+		{&Scope{HostMode: HostAllowlist, Hosts: []string{"cdn.example.net", "localhost:8000"}}, "http://www.example.com/", false},
+		{&Scope{HostMode: HostAllowlist, Hosts: []string{"CDN.Example.net"}}, "http://cdn.example.net/", true},
+		{&Scope{HostMode: HostAllowlist, Hosts: []string{"cdn.example.net:443"}}, "https://cdn.example.net/", true},
+		{&Scope{HostMode: HostAllowlist, Hosts: []string{"cdn.example.net:443"}}, "http://cdn.example.net/", false},
+		{&Scope{HostMode: HostSameOrigin}, "http://docs.example.com:80/a", true},
+		{&Scope{HostMode: HostSameOrigin}, "https://docs.example.com/a", false},
+		{&Scope{HostMode: HostSameOrigin}, "http://docs.example.com:8080/a", false},
+	}
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.url)
+		assert.Equal(t, tt.match, tt.scope.hostMatcher(root)(u), "%v %s", tt.scope, tt.url)
+	}
+
+	ip, _ := url.Parse("http://127.0.0.1:8000/")
+	other, _ := url.Parse("http://127.0.0.2:8000/")
+	assert.True(t, (&Scope{HostMode: HostSubdomains}).hostMatcher(ip)(ip))
+	assert.False(t, (&Scope{HostMode: HostSubdomains}).hostMatcher(ip)(other))
+}
+
+func TestCrawlerHosts(t *testing.T) {
+	site := map[string][]string{
+		"http://docs.example.com/":     {"http://www.example.com/", "http://api.example.com/ref", "http://example.org/"},
+		"http://www.example.com/":      {"http://docs.example.com/", "/about"},
+		"http://www.example.com/about": {},
+		"http://api.example.com/ref":   {},
+	}
+	var lock sync.Mutex
+	var fetched []string
+	fetcher := func(p Page) []*url.URL {
+		lock.Lock()
+		fetched = append(fetched, p.URL().String())
+		lock.Unlock()
+		return mapURLs(p.URL(), site[p.URL().String()])
+	}
+
+	c := NewCrawler(2, PageFetcherFunc(fetcher))
+	c.Scope = &Scope{HostMode: HostSubdomains}
+	cr, err := c.Crawl("http://docs.example.com/")
+	assert.NoError(t, err)
+	sort.Strings(fetched)
+	assert.Equal(t, []string{
+		"http://api.example.com/ref",
+		"http://docs.example.com/",
+		"http://www.example.com/",
+		"http://www.example.com/about",
+	}, fetched)
+	assert.Equal(t, PageExternal, cr.Root().Links()[2].Status(), "links to other domains are external")
+
+	assert.Equal(t, map[string][]string{
+		"api.example.com":  {"http://api.example.com/ref"},
+		"docs.example.com": {"http://docs.example.com/"},
+		"example.org":      {"http://example.org/"},
+		"www.example.com":  {"http://www.example.com/", "http://www.example.com/about"},
+	}, cr.ByHost())
+}
@@ -0,0 +1,279 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// maxSitemapSize is the most of a sitemap that is parsed, after any decompression,
+// which is the limit of the sitemaps protocol.
+const maxSitemapSize = 50 * 1024 * 1024
+
+// maxSitemapDepth limits how deep sitemap indexes are followed. The protocol does
+// not allow an index to list other indexes, but some sites do.
+const maxSitemapDepth = 3
+
+// Sitemap is a parsed sitemap file, which either lists pages or, as a sitemap
+// index, other sitemaps.
+type Sitemap struct {
+	// URLs are the locations of the pages listed.
+	URLs []string
+	// Sitemaps are the locations of the sitemaps listed by a sitemap index.
+	Sitemaps []string
+}
+
+type sitemapXML struct {
+	URLs []struct {
+		Loc string `xml:"loc"`
+	} `xml:"url"`
+	Sitemaps []struct {
+		Loc string `xml:"loc"`
+	} `xml:"sitemap"`
+}
+
+// ParseSitemap parses a sitemap or a sitemap index, which may be gzip compressed.
+func ParseSitemap(r io.Reader) (*Sitemap, error) {
+	br := bufio.NewReader(r)
+	// gzip is detected by its header, as servers often do not say
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = br
+	}
+
+	var sx sitemapXML
+	if err := xml.NewDecoder(io.LimitReader(r, maxSitemapSize)).Decode(&sx); err != nil {
+		return nil, err
+	}
+	sm := &Sitemap{}
+	for _, u := range sx.URLs {
+		if loc := strings.TrimSpace(u.Loc); loc != "" {
+			sm.URLs = append(sm.URLs, loc)
+		}
+	}
+	for _, s := range sx.Sitemaps {
+		if loc := strings.TrimSpace(s.Loc); loc != "" {
+			sm.Sitemaps = append(sm.Sitemaps, loc)
+		}
+	}
+	return sm, nil
+}
+
+// fetchSitemap retrieves and parses the sitemap at u.
+func (f *httpFetcher) fetchSitemap(ctx context.Context, u *url.URL) (*Sitemap, error) {
+	ctx, cancel := f.withTimeout(ctx)
+	defer cancel()
+	res, _, err := f.get(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("non 200 status code received: %v", res.StatusCode)
+	}
+	return ParseSitemap(res.Body)
+}
+
+// SitemapReport compares the pages listed in the sitemaps of a crawl with the
+// pages found by following links.
+type SitemapReport struct {
+	// Sitemaps are the URLs of the sitemaps that were read, including those
+	// listed in sitemap indexes.
+	Sitemaps []string `json:"sitemaps"`
+	// Listed is the number of pages listed in the sitemaps that are within the crawl.
+	Listed int `json:"listed"`
+	// Unlinked are the listed pages that no link leads to from the root.
+	Unlinked []string `json:"unlinked,omitempty"`
+	// Unlisted are the pages found by following links from the root that are not
+	// listed, leaving out noindex pages and pages that could not be fetched.
+	Unlisted []string `json:"unlisted,omitempty"`
+	// Errors are the listed pages that could not be fetched.
+	Errors []SitemapError `json:"errors,omitempty"`
+	// SitemapErrors are the sitemaps that could not be read.
+	SitemapErrors []SitemapError `json:"sitemaperrors,omitempty"`
+}
+
+// SitemapError is a URL from the sitemaps that could not be retrieved.
+type SitemapError struct {
+	URL   string `json:"url"`
+	Error string `json:"error"`
+}
+
+// readSitemaps reads the sitemaps at urls with fetcher, and the sitemaps they
+// list, making at most maxRequests simultaneous requests. It returns the listed
+// pages that are within the crawl, normalized and without duplicates, and
+// starts a report on them.
+func (cs *crawlerState) readSitemaps(fetcher *httpFetcher, maxRequests int, urls []*url.URL) ([]*url.URL, *SitemapReport) {
+	pm := cs.pageMap
+	report := &SitemapReport{}
+	seenSitemaps := map[string]bool{}
+	for _, u := range urls {
+		seenSitemaps[u.String()] = true
+	}
+	seenPages := map[string]bool{}
+	var pages []*url.URL
+	var lock sync.Mutex
+	for depth := 0; len(urls) > 0 && depth <= maxSitemapDepth && cs.ctx.Err() == nil; depth++ {
+		var next []*url.URL
+		cs.runAll(maxRequests, urls, func(u *url.URL) {
+			if !cs.wait(u) {
+				return
+			}
+			sm, err := fetcher.fetchSitemap(cs.ctx, u)
+			lock.Lock()
+			defer lock.Unlock()
+			report.Sitemaps = append(report.Sitemaps, u.String())
+			if err != nil {
+				report.SitemapErrors = append(report.SitemapErrors, SitemapError{u.String(), err.Error()})
+				return
+			}
+			for _, s := range sm.Sitemaps {
+				if su := resolveRef(u, s); su != nil && !seenSitemaps[su.String()] {
+					seenSitemaps[su.String()] = true
+					next = append(next, su)
+				}
+			}
+			for _, loc := range sm.URLs {
+				lu := resolveRef(u, loc)
+				if lu == nil {
+					continue
+				}
+				lu = pm.normalize.Normalize(lu)
+				if !pm.inHost(lu) || !pm.scope.Allowed(lu) {
+					continue
+				}
+				lu = pm.scope.strip(lu)
+				if k := pageKey(lu); !seenPages[k] {
+					seenPages[k] = true
+					pages = append(pages, lu)
+				}
+			}
+		})
+		urls = next
+	}
+	sort.Strings(report.Sitemaps)
+	report.Listed = len(pages)
+	return pages, report
+}
+
+// sitemapURLs returns the sitemaps to read for a crawl from root: those given,
+// and if fromRobots is set, those in the robots.txt of the root host, or
+// /sitemap.xml if it lists none.
+func (cs *crawlerState) sitemapURLs(fetcher *httpFetcher, agent string, root *url.URL, given []string, fromRobots bool) []*url.URL {
+	var urls []*url.URL
+	for _, s := range given {
+		if u := resolveRef(root, s); u != nil {
+			urls = append(urls, u)
+		}
+	}
+	if !fromRobots {
+		return urls
+	}
+	robots := cs.pageMap.robots.get(root)
+	if robots == nil {
+		// robots.txt is only read for its sitemaps
+		robots, _ = fetcher.fetchRobots(cs.ctx, root, agent)
+	}
+	var listed []string
+	if robots != nil {
+		listed = robots.Sitemaps
+	}
+	if len(listed) == 0 {
+		listed = []string{"/sitemap.xml"}
+	}
+	for _, s := range listed {
+		if u := resolveRef(root, s); u != nil {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+// seedSitemapURLs is like sitemapURLs for a crawl from several roots, reading the
+// robots.txt of each of their hosts. The given sitemaps are relative to the first.
+func (cs *crawlerState) seedSitemapURLs(fetcher *httpFetcher, agent string, roots []Page, given []string, fromRobots bool) []*url.URL {
+	var urls []*url.URL
+	seen := map[string]bool{}
+	hosts := map[string]bool{}
+	for i, r := range roots {
+		if i > 0 {
+			given = nil
+		}
+		for _, u := range cs.sitemapURLs(fetcher, agent, r.URL(), given, fromRobots && !hosts[r.URL().Host]) {
+			if !seen[u.String()] {
+				seen[u.String()] = true
+				urls = append(urls, u)
+			}
+		}
+		hosts[r.URL().Host] = true
+	}
+	return urls
+}
+
+// finish completes the report once the crawl is done. The pages found by links
+// are those that can be reached from roots by following links and redirects.
+func (r *SitemapReport) finish(pm *pageMap, roots []Page, listed []*url.URL) {
+	if r == nil {
+		return
+	}
+	reached := map[*page]bool{}
+	queue := make([]*page, 0, len(roots))
+	for _, p := range roots {
+		queue = append(queue, p.(*page))
+	}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		if reached[p] {
+			continue
+		}
+		reached[p] = true
+		if p.canonical != nil {
+			queue = append(queue, p.canonical)
+		}
+		for _, lp := range p.linked {
+			queue = append(queue, lp.(*page))
+		}
+	}
+
+	inSitemap := map[*page]bool{}
+	for _, u := range listed {
+		p, _ := pm.pages[pageKey(u)].(*page)
+		if p == nil {
+			continue
+		}
+		inSitemap[p] = true
+		if p.canonical != nil {
+			inSitemap[p.canonical] = true
+		}
+		if !reached[p] {
+			r.Unlinked = append(r.Unlinked, u.String())
+		}
+		if p.status == PageFetched && p.err != nil {
+			r.Errors = append(r.Errors, SitemapError{u.String(), p.err.Error()})
+		}
+	}
+	for p := range reached {
+		if p.status == PageFetched && p.err == nil && !p.noIndex && !inSitemap[p] {
+			r.Unlisted = append(r.Unlisted, p.url.String())
+		}
+	}
+	sort.Strings(r.Unlinked)
+	sort.Strings(r.Unlisted)
+	sort.Slice(r.Errors, func(i, j int) bool { return r.Errors[i].URL < r.Errors[j].URL })
+	sort.Slice(r.SitemapErrors, func(i, j int) bool { return r.SitemapErrors[i].URL < r.SitemapErrors[j].URL })
+}
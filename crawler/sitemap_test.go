@@ -0,0 +1,105 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testSitemap = `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc> http://testhost.local/ </loc><lastmod>2014-06-12</lastmod></url>
+  <url><loc>http://testhost.local/about.html</loc></url>
+</urlset>`
+
+func gzipped(s string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(s))
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestParseSitemap(t *testing.T) {
+	sm, err := ParseSitemap(strings.NewReader(testSitemap))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"http://testhost.local/", "http://testhost.local/about.html"}, sm.URLs)
+	assert.Nil(t, sm.Sitemaps)
+
+	sm, err = ParseSitemap(bytes.NewReader(gzipped(testSitemap)))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(sm.URLs), "gzip is detected")
+
+	sm, err = ParseSitemap(strings.NewReader(`<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<sitemap><loc>http://testhost.local/sitemap1.xml</loc></sitemap>
+<sitemap><loc>http://testhost.local/sitemap2.xml.gz</loc></sitemap>
+</sitemapindex>`))
+	assert.NoError(t, err)
+	assert.Nil(t, sm.URLs)
+	assert.Equal(t, []string{"http://testhost.local/sitemap1.xml", "http://testhost.local/sitemap2.xml.gz"}, sm.Sitemaps)
+
+	_, err = ParseSitemap(strings.NewReader("<urlset><url>"))
+	assert.Error(t, err)
+}
+
+func TestCrawlerSitemaps(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nDisallow:\nSitemap: " + ts.URL + "/sitemap_index.xml\n"))
+		case "/sitemap_index.xml":
+			w.Write([]byte(`<sitemapindex><sitemap><loc>/pages.xml.gz</loc></sitemap>
+<sitemap><loc>/gone.xml</loc></sitemap><sitemap><loc>/sitemap_index.xml</loc></sitemap></sitemapindex>`))
+		case "/pages.xml.gz":
+			w.Write(gzipped(`<urlset>
+<url><loc>` + ts.URL + `/</loc></url>
+<url><loc>` + ts.URL + `/orphan.html</loc></url>
+<url><loc>` + ts.URL + `/missing.html</loc></url>
+<url><loc>` + ts.URL + `/old.html</loc></url>
+<url><loc>http://other.local/page.html</loc></url>
+</urlset>`))
+		case "/":
+			w.Write([]byte(`<html><body><a href="/linked.html">Linked</a><a href="/new.html">New</a></body></html>`))
+		case "/linked.html", "/orphan.html", "/new.html":
+			w.Write([]byte(`<html><body></body></html>`))
+		case "/old.html":
+			http.Redirect(w, r, "/new.html", 301)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	c := NewCrawler(2, nil)
+	cr, err := c.Crawl(ts.URL + "/")
+	assert.NoError(t, err)
+	assert.Nil(t, cr.Sitemap(), "sitemaps are not read by default")
+
+	c.UseSitemaps = true
+	cr, err = c.Crawl(ts.URL + "/")
+	assert.NoError(t, err)
+	assert.Equal(t, 200, cr.LookupTable()[ts.URL+"/orphan.html"].StatusCode, "listed pages are crawled")
+	assert.Equal(t, &SitemapReport{
+		Sitemaps: []string{ts.URL + "/gone.xml", ts.URL + "/pages.xml.gz", ts.URL + "/sitemap_index.xml"},
+		Listed:   4,
+		Unlinked: []string{ts.URL + "/missing.html", ts.URL + "/old.html", ts.URL + "/orphan.html"},
+		Unlisted: []string{ts.URL + "/linked.html"},
+		Errors:   []SitemapError{{ts.URL + "/missing.html", "non 200 status code received: 404"}},
+		SitemapErrors: []SitemapError{
+			{ts.URL + "/gone.xml", "non 200 status code received: 404"},
+		},
+	}, cr.Sitemap())
+
+	c.UseSitemaps = false
+	c.SitemapURLs = []string{"/pages.xml.gz"}
+	cr, err = c.Crawl(ts.URL + "/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{ts.URL + "/pages.xml.gz"}, cr.Sitemap().Sitemaps)
+	assert.Equal(t, 4, cr.Sitemap().Listed)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/jkl1337/docrawl/crawler"
+)
+
+// Authentication settings are never taken from the command line, where they would
+// be visible to other users. They come from these environment variables, or from
+// a file of NAME=value lines with the same names given with -auth.
+const (
+	envUsername    = "DOCRAWL_USERNAME"
+	envPassword    = "DOCRAWL_PASSWORD"
+	envBearerToken = "DOCRAWL_BEARER_TOKEN"
+	envLoginURL    = "DOCRAWL_LOGIN_URL"
+	envLoginForm   = "DOCRAWL_LOGIN_FORM"
+)
+
+var authNames = []string{envUsername, envPassword, envBearerToken, envLoginURL, envLoginForm}
+
+// readAuthFile reads NAME=value lines, skipping blank lines and # comments.
+func readAuthFile(name string) (map[string]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	settings := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		eq := strings.IndexByte(line, '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("%s:%d: expected NAME=value", name, n)
+		}
+		settings[strings.TrimSpace(line[:eq])] = strings.TrimSpace(line[eq+1:])
+	}
+	return settings, scanner.Err()
+}
+
+// authOptions fills in the authentication options for a crawl of root. Settings in
+// the file authFile, if given, take precedence over the environment.
+func authOptions(opts *crawler.HTTPOptions, root *url.URL, authFile string) error {
+	if root.User != nil {
+		return fmt.Errorf("credentials in the URL are not allowed, use %s and %s", envUsername, envPassword)
+	}
+
+	settings := map[string]string{}
+	for _, name := range authNames {
+		if v := os.Getenv(name); v != "" {
+			settings[name] = v
+		}
+	}
+	if authFile != "" {
+		fs, err := readAuthFile(authFile)
+		if err != nil {
+			return err
+		}
+		for name, v := range fs {
+			settings[name] = v
+		}
+	}
+
+	if settings[envUsername] != "" || settings[envBearerToken] != "" {
+		opts.Credentials = &crawler.Credentials{
+			Host:        root.Host,
+			Scheme:      root.Scheme,
+			Username:    settings[envUsername],
+			Password:    settings[envPassword],
+			BearerToken: settings[envBearerToken],
+		}
+	}
+	if settings[envLoginURL] != "" {
+		form, err := url.ParseQuery(settings[envLoginForm])
+		if err != nil {
+			return fmt.Errorf("%s: %v", envLoginForm, err)
+		}
+		// a relative login URL is on the crawled host
+		loginURL, err := root.Parse(settings[envLoginURL])
+		if err != nil {
+			return fmt.Errorf("%s: %v", envLoginURL, err)
+		}
+		opts.LoginURL = loginURL.String()
+		opts.LoginForm = form
+	}
+	return nil
+}
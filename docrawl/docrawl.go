@@ -1,16 +1,18 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
-	"net/url"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"time"
 
 	gv "code.google.com/p/gographviz"
 	"github.com/jkl1337/docrawl/crawler"
@@ -19,9 +21,30 @@ import (
 var (
 	verbose      = flag.Bool("v", false, "Produce some log messages about activity")
 	maxRequests  = flag.Int("maxreq", 2, "Maximum number of simultaneous http requests")
-	outputFormat = flag.String("f", "json", "Output format: json: JSON, dot: Graphviz DOT, off: none")
+	outputFormat = flag.String("f", "json", "Output format: json: JSON, dot: Graphviz DOT, sitemap: sitemaps.org XML, off: none")
 	pretty       = flag.Bool("pretty", false, "Pretty print JSON output")
 	outputName   = flag.String("o", "", "Output filename, defaults to crawled hostname")
+	maxDepth     = flag.Int("depth", 0, "Maximum link depth from the root URL to fetch, 0 for no limit")
+	maxPages     = flag.Int("maxpages", 0, "Maximum number of pages to fetch, 0 for no limit")
+	userAgent    = flag.String("agent", crawler.DefaultUserAgent, "User agent for requests and robots.txt rules")
+	noRobots     = flag.Bool("norobots", false, "Ignore robots.txt, only for sites you own")
+	robotsMeta   = flag.Bool("robotsmeta", false, "Honour robots meta tags, X-Robots-Tag headers and rel=nofollow links")
+	reqTimeout   = flag.Duration("reqtimeout", 30*time.Second, "Timeout for each page fetch, 0 for no limit")
+	insecure     = flag.Bool("insecure", false, "Do not verify TLS certificates, for self-signed staging servers")
+	authFile     = flag.String("auth", "", "File of DOCRAWL_* authentication settings, see README")
+	timeout      = flag.Duration("timeout", 0, "Stop crawling after this long and write the partial result, 0 for no limit")
+	rate         = flag.Float64("rate", 0, "Maximum number of requests per second, 0 for no limit")
+	delay        = flag.Duration("delay", 0, "Minimum delay between requests, a longer robots.txt Crawl-delay takes precedence")
+	adaptive     = flag.Bool("adaptive", false, "Slow down when the server responds slowly or with 429 Too Many Requests")
+	checkLinks   = flag.Bool("checklinks", false, "Check that external links are reachable once the crawl is done")
+	checkReq     = flag.Int("checkreq", 4, "Maximum number of simultaneous external link checks and asset requests")
+	crawlCSS     = flag.Bool("css", false, "Fetch stylesheets on the crawled hosts and add the fonts and images they reference to the assets")
+	verifyAssets = flag.Bool("verifyassets", false, "Request each asset once the crawl is done and report broken ones")
+	metaFields   = flag.String("meta", "all", "Page metadata to record: all, none or a comma separated list of url, type, length, time, lastmodified, etag, title, description, canonical, lang, h1, words, alternates")
+	useSitemaps  = flag.Bool("sitemaps", false, "Also crawl the pages in the sitemaps of robots.txt, or /sitemap.xml, and report on them")
+	sitemapURLs  = flag.String("sitemap", "", "Comma separated URLs of sitemaps to crawl the pages of and report on")
+	sitemapBase  = flag.String("sitemapbase", "", "URL the files of a split sitemap are published under, defaults to the root of the crawled host")
+	retries      = flag.Int("retries", 2, "Number of times to retry a page after a transient network error or 429, 502, 503, 504 status")
 )
 
 type ResultFormatter interface {
@@ -31,7 +54,7 @@ type ResultFormatter interface {
 
 func main() {
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s [OPTIONS] ROOT-URL\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage: %s [OPTIONS] ROOT-URL [SEED-URL...]\n", os.Args[0])
 		flag.PrintDefaults()
 	}
 	flag.Parse()
@@ -42,38 +65,99 @@ func main() {
 		serializer = jsonWriter{}
 	case "dot":
 		serializer = dotWriter{}
+	case "sitemap":
+		serializer = &sitemapWriter{base: *sitemapBase}
 	case "off":
 	default:
 		fmt.Fprintf(os.Stderr, "Invalid output format")
 		os.Exit(2)
 	}
 
-	rooturl := flag.Arg(0)
-	if rooturl == "" {
+	seeds, err := seedURLs()
+	if err != nil {
+		log.Fatalln("Unable to read seeds:", err)
+	}
+	if len(seeds) == 0 {
 		flag.Usage()
 		os.Exit(2)
 	}
 
-	fetcher := crawler.FetchPageHTTP
-	if *verbose {
-		fetcher = func(p crawler.Page) []*url.URL {
-			log.Println("Fetching:", p.URL().String())
-			return crawler.FetchPageHTTP(p)
-		}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if *timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
 	}
+	// The first interrupt stops the crawl so the partial result can be written,
+	// a second one terminates the process as usual.
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	go func() {
+		if _, ok := <-sigs; ok {
+			log.Println("Interrupted, writing partial result")
+			signal.Stop(sigs)
+			cancel()
+		}
+	}()
 
+	u, err := rootURL(seeds)
+	if err != nil {
+		log.Fatalln("Invalid seeds:", err)
+	}
+	opts := crawler.HTTPOptions{
+		UserAgent:          *userAgent,
+		Timeout:            *reqTimeout,
+		InsecureSkipVerify: *insecure,
+		Cookies:            true,
+	}
+	if err := authOptions(&opts, u, *authFile); err != nil {
+		log.Fatalln("Authentication settings:", err)
+	}
+	fetcher := crawler.NewHTTPFetcher(nil, opts)
 	c := crawler.NewCrawler(*maxRequests, fetcher)
-	cr, err := c.Crawl(rooturl)
+	if *verbose {
+		c.Observer = crawler.ObserverFunc(logEvent)
+	}
+	c.MaxDepth = *maxDepth
+	c.MaxPages = *maxPages
+	c.RespectRobots = !*noRobots
+	c.RespectRobotsMeta = *robotsMeta
+	c.UserAgent = *userAgent
+	if c.Scope, err = scope(); err != nil {
+		log.Fatalln("Invalid -hosts:", err)
+	}
+	if c.Normalizer, err = normalizer(); err != nil {
+		log.Fatalln("Invalid -normalize:", err)
+	}
+	c.CheckExternal = *checkLinks
+	c.CheckRequests = *checkReq
+	c.VerifyAssets = *verifyAssets
+	c.CrawlStylesheets = *crawlCSS
+	c.UseSitemaps = *useSitemaps
+	c.SitemapURLs = splitList(*sitemapURLs)
+	if c.Metadata, err = crawler.ParseMetaFields(*metaFields); err != nil {
+		log.Fatalln("Invalid -meta:", err)
+	}
+	c.RateLimit = crawler.RateLimit{Rate: *rate, Delay: *delay, Adaptive: *adaptive}
+	c.Retry = crawler.RetryPolicy{Attempts: *retries + 1, BaseDelay: time.Second, MaxDelay: 30 * time.Second}
+	cr, err := c.CrawlSeeds(ctx, seeds)
+	signal.Stop(sigs)
 
-	if err != nil {
+	if cr == nil {
 		log.Fatalln("Crawler failed", err)
 	}
+	if err != nil {
+		log.Println("Crawl stopped early:", err)
+	}
 
 	if serializer != nil {
 		name := *outputName
 		if name == "" {
 			name = fmt.Sprintf("%s.%s", cr.Root().URL().Host, serializer.Ext())
 		}
+		if sw, ok := serializer.(*sitemapWriter); ok {
+			sw.name = name
+		}
 		var f io.Writer
 		if name == "-" {
 			f = os.Stdout
@@ -91,6 +175,23 @@ func main() {
 	}
 }
 
+func logEvent(e crawler.Event) {
+	switch e.Type {
+	case crawler.EventFetchStarted:
+		log.Println("Fetching:", e.Page.URL().String())
+	case crawler.EventFetchFinished:
+		if e.Err != nil {
+			log.Printf("Failed: %s: %v", e.Page.URL().String(), e.Err)
+		}
+	case crawler.EventLinkChecked:
+		if e.Err != nil {
+			log.Printf("Broken link: %s: %v", e.Page.URL().String(), e.Err)
+		}
+	case crawler.EventCrawlFinished:
+		log.Println("Crawl finished")
+	}
+}
+
 type jsonWriter struct{}
 
 func (j jsonWriter) Ext() string {
@@ -100,9 +201,18 @@ func (j jsonWriter) Ext() string {
 func (j jsonWriter) Write(w io.Writer, cr *crawler.Result) error {
 	var err error
 	var bs []byte
+	roots := make([]string, len(cr.Roots()))
+	for i, r := range cr.Roots() {
+		roots[i] = r.URL().String()
+	}
 	toplevel := map[string]interface{}{
 		"root":  cr.Root().URL().String(),
+		"roots": roots,
 		"pages": cr.LookupTable(),
+		"hosts": cr.ByHost(),
+	}
+	if sm := cr.Sitemap(); sm != nil {
+		toplevel["sitemap"] = sm
 	}
 	if *pretty {
 		bs, err = json.MarshalIndent(toplevel, "", "  ")
@@ -125,7 +235,16 @@ func (j dotWriter) Ext() string {
 func nodeLabel(p crawler.Page) string {
 	abuf := make([]string, 0)
 	for _, a := range p.Assets() {
-		abuf = append(abuf, (*url.URL)(a).String())
+		if a.Broken() {
+			abuf = append(abuf, fmt.Sprintf("BROKEN %s (%v)", a.URL.String(), a.Err))
+		} else {
+			abuf = append(abuf, a.URL.String())
+		}
+	}
+	if p.Status() == crawler.PageRedirect {
+		for _, r := range p.Redirects() {
+			abuf = append(abuf, fmt.Sprintf("%d %s", r.StatusCode, r.URL.String()))
+		}
 	}
 	abuf = append(abuf, "")
 	assetsStr := strings.Join(abuf, "\\l")
@@ -146,24 +265,55 @@ func (j dotWriter) Write(w io.Writer, cr *crawler.Result) (err error) {
 		return "P" + strconv.FormatInt(int64(visited[p]), 10)
 	}
 
+	// the pages of each host are grouped in a cluster
+	clusters := map[string]string{}
+	cluster := func(host string) string {
+		if c, ok := clusters[host]; ok {
+			return c
+		}
+		c := "cluster_" + strconv.Itoa(len(clusters))
+		clusters[host] = c
+		g.AddSubGraph(name, c, map[string]string{"label": host})
+		return c
+	}
+
 	var walkPage func(p crawler.Page)
 	walkPage = func(p crawler.Page) {
 		nodeAttrs := map[string]string{
 			"shape": "record",
 			"label": nodeLabel(p),
 		}
-		g.AddNode(name, pageID(p), nodeAttrs)
-
-		edges := map[crawler.Page]int{}
+		for _, a := range p.Assets() {
+			if a.Broken() {
+				nodeAttrs["color"] = "red"
+			}
+		}
+		if p.Status() == crawler.PageExternal {
+			// external links are plain boxes, red if they are broken
+			nodeAttrs = map[string]string{
+				"shape": "box",
+				"style": "dashed",
+				"label": p.URL().String(),
+			}
+			if p.Error() != nil {
+				nodeAttrs["color"] = "red"
+			}
+		}
+		g.AddNode(cluster(p.URL().Host), pageID(p), nodeAttrs)
 
-		for _, lp := range p.Links() {
-			edges[lp]++
+		visit := func(lp crawler.Page) {
 			if visited[lp] == 0 {
 				visited[lp] = labelCount
 				labelCount++
 				walkPage(lp)
 			}
 		}
+		edges := map[crawler.Page]int{}
+
+		for _, lp := range p.Links() {
+			edges[lp]++
+			visit(lp)
+		}
 		for lp, w := range edges {
 			var edgeAttrs map[string]string
 			if w > 1 {
@@ -173,11 +323,26 @@ func (j dotWriter) Write(w io.Writer, cr *crawler.Result) (err error) {
 			}
 			g.AddEdge(pageID(p), pageID(lp), true, edgeAttrs)
 		}
+		// redirects are drawn dashed and labelled with the status codes
+		if cp := p.Canonical(); cp != nil {
+			visit(cp)
+			codes := make([]string, len(p.Redirects()))
+			for i, r := range p.Redirects() {
+				codes[i] = strconv.Itoa(r.StatusCode)
+			}
+			g.AddEdge(pageID(p), pageID(cp), true, map[string]string{
+				"style": "dashed",
+				"label": strings.Join(codes, ","),
+			})
+		}
+	}
+	for _, r := range cr.Roots() {
+		if visited[r] == 0 {
+			visited[r] = labelCount
+			labelCount++
+			walkPage(r)
+		}
 	}
-	r := cr.Root()
-	visited[r] = labelCount
-	labelCount++
-	walkPage(r)
 
 	// sigh, gographviz leaks panics
 	defer func() {
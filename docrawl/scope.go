@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/jkl1337/docrawl/crawler"
+)
+
+// ruleFlag is a repeatable flag of scope rules.
+type ruleFlag []crawler.ScopeRule
+
+func (f *ruleFlag) String() string {
+	return ""
+}
+
+func (f *ruleFlag) Set(s string) error {
+	r, err := crawler.ParseScopeRule(s)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, r)
+	return nil
+}
+
+var (
+	includeRules ruleFlag
+	excludeRules ruleFlag
+	stripParams  = flag.String("strip", "", "Comma separated query parameters to remove from links, name* matches by prefix")
+	normalize    = flag.String("normalize", "", "Comma separated URL normalizations: lower: lower case paths, index: drop index.html and the like, slash: drop trailing slashes, sort: sort query parameters, tracking: drop utm_* and click id parameters, http or https: use one scheme for both")
+	hosts        = flag.String("hosts", "exact", "Hosts to crawl: exact: the root host, subdomains: the root domain, origin: the root scheme, host and port, list:HOST,...: the root host and the listed hosts")
+)
+
+func init() {
+	flag.Var(&includeRules, "include", "Only crawl URLs matching a path prefix, glob:PATTERN or re:EXPR rule, may be repeated")
+	flag.Var(&excludeRules, "exclude", "Do not crawl URLs matching a path prefix, glob:PATTERN or re:EXPR rule, may be repeated")
+}
+
+// scope returns the crawl scope of the flags, or nil if the whole root host is crawled.
+func scope() (*crawler.Scope, error) {
+	if len(includeRules) == 0 && len(excludeRules) == 0 && *stripParams == "" && *hosts == "exact" {
+		return nil, nil
+	}
+	s := &crawler.Scope{
+		Include:     includeRules,
+		Exclude:     excludeRules,
+		StripParams: splitList(*stripParams),
+	}
+	switch {
+	case *hosts == "exact":
+	case *hosts == "subdomains":
+		s.HostMode = crawler.HostSubdomains
+	case *hosts == "origin":
+		s.HostMode = crawler.HostSameOrigin
+	case strings.HasPrefix(*hosts, "list:"):
+		s.HostMode = crawler.HostAllowlist
+		s.Hosts = splitList((*hosts)[len("list:"):])
+	default:
+		return nil, fmt.Errorf("unknown host mode: %q", *hosts)
+	}
+	return s, nil
+}
+
+// normalizer returns the URL normalizer of the flags, or nil for the default.
+func normalizer() (crawler.Normalizer, error) {
+	if *normalize == "" {
+		return nil, nil
+	}
+	n := &crawler.URLNormalizer{}
+	for _, item := range splitList(*normalize) {
+		switch item {
+		case "lower":
+			n.LowerCasePath = true
+		case "index":
+			n.IndexNames = []string{"index.html", "index.htm", "index.php", "default.htm", "default.aspx"}
+		case "slash":
+			n.TrimTrailingSlash = true
+		case "sort":
+			n.SortQuery = true
+		case "tracking":
+			n.DropParams = []string{"utm_*", "gclid", "fbclid", "msclkid"}
+		case "http", "https":
+			n.Scheme = item
+		default:
+			return nil, fmt.Errorf("unknown normalization: %q", item)
+		}
+	}
+	return n, nil
+}
+
+// splitList splits a comma separated list, dropping empty items.
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+)
+
+var seedsFile = flag.String("seeds", "", "File of further seed URLs, one per line, - for stdin")
+
+// readSeeds reads URLs from r, one per line, skipping blank lines and # comments.
+func readSeeds(r io.Reader) ([]string, error) {
+	var seeds []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		seeds = append(seeds, line)
+	}
+	return seeds, scanner.Err()
+}
+
+// seedURLs returns the seeds of the crawl: the arguments followed by those of the
+// -seeds file. Without either, seeds are read from stdin if it is not a terminal.
+func seedURLs() ([]string, error) {
+	seeds := flag.Args()
+	name := *seedsFile
+	if name == "" && len(seeds) == 0 {
+		if fi, err := os.Stdin.Stat(); err == nil && fi.Mode()&os.ModeCharDevice == 0 {
+			name = "-"
+		}
+	}
+
+	var r io.Reader
+	switch name {
+	case "":
+		return seeds, nil
+	case "-":
+		r = os.Stdin
+	default:
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	more, err := readSeeds(r)
+	return append(seeds, more...), err
+}
+
+// rootURL returns the first seed, which the crawl is rooted at and any
+// credentials are tied to. The other seeds may not carry credentials of their
+// own; those of the root are rejected by authOptions.
+func rootURL(seeds []string) (*url.URL, error) {
+	root, err := url.Parse(seeds[0])
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range seeds[1:] {
+		su, err := url.Parse(s)
+		if err != nil {
+			return nil, err
+		}
+		if su.User != nil {
+			return nil, errors.New("credentials in seed URLs are not allowed")
+		}
+	}
+	return root, nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadSeeds(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"http://a.local/\n", []string{"http://a.local/"}},
+		{"http://a.local/\nhttp://b.local/x", []string{"http://a.local/", "http://b.local/x"}},
+		{"\n  \n\thttp://a.local/  \n\n", []string{"http://a.local/"}},
+		{"# seeds\nhttp://a.local/\n  # indented comment\n", []string{"http://a.local/"}},
+		{"http://a.local/#top\n", []string{"http://a.local/#top"}},
+		{"a.local\n://bad\n", []string{"a.local", "://bad"}},
+		{"\r\nhttp://a.local/\r\n", []string{"http://a.local/"}},
+	}
+	for _, tt := range tests {
+		seeds, err := readSeeds(strings.NewReader(tt.in))
+		assert.NoError(t, err)
+		assert.Equal(t, tt.want, seeds, "%q", tt.in)
+	}
+}
+
+func TestSeedURLsFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "docrawl-seeds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("# more seeds\nhttp://b.local/\n\nhttp://c.local/\n")
+	f.Close()
+
+	defer func(name string) { *seedsFile = name }(*seedsFile)
+	*seedsFile = f.Name()
+	seeds, err := seedURLs()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"http://b.local/", "http://c.local/"}, seeds)
+
+	*seedsFile = f.Name() + ".missing"
+	_, err = seedURLs()
+	assert.Error(t, err)
+}
+
+func TestRootURL(t *testing.T) {
+	tests := []struct {
+		seeds []string
+		root  string
+		err   string
+	}{
+		{[]string{"http://a.local/"}, "http://a.local/", ""},
+		{[]string{"http://a.local/docs/", "http://b.local/"}, "http://a.local/docs/", ""},
+		{[]string{"://bad"}, "", "missing protocol scheme"},
+		{[]string{"http://a.local/", "://bad"}, "", "missing protocol scheme"},
+		{[]string{"http://a.local/", "http://user:pw@b.local/"}, "", "credentials in seed URLs are not allowed"},
+		// the root is left to authOptions, which suggests the environment instead
+		{[]string{"http://user:pw@a.local/"}, "http://user:pw@a.local/", ""},
+	}
+	for _, tt := range tests {
+		root, err := rootURL(tt.seeds)
+		if tt.err != "" {
+			if assert.Error(t, err, "%v", tt.seeds) {
+				assert.Contains(t, err.Error(), tt.err)
+			}
+			continue
+		}
+		if assert.NoError(t, err, "%v", tt.seeds) {
+			assert.Equal(t, tt.root, root.String())
+		}
+	}
+}
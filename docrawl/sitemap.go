@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jkl1337/docrawl/crawler"
+)
+
+// maxSitemapURLs is the most URLs a sitemap file may list. Larger sitemaps are
+// split into several files listed by a sitemap index.
+const maxSitemapURLs = 50000
+
+const (
+	sitemapNS = "http://www.sitemaps.org/schemas/sitemap/0.9"
+	xhtmlNS   = "http://www.w3.org/1999/xhtml"
+)
+
+type urlsetXML struct {
+	XMLName xml.Name `xml:"urlset"`
+	NS      string   `xml:"xmlns,attr"`
+	XHTMLNS string   `xml:"xmlns:xhtml,attr,omitempty"`
+	URLs    []urlXML `xml:"url"`
+}
+
+type urlXML struct {
+	Loc     string         `xml:"loc"`
+	LastMod string         `xml:"lastmod,omitempty"`
+	Links   []xhtmlLinkXML `xml:"xhtml:link"`
+}
+
+type xhtmlLinkXML struct {
+	Rel      string `xml:"rel,attr"`
+	HrefLang string `xml:"hreflang,attr"`
+	Href     string `xml:"href,attr"`
+}
+
+type sitemapIndexXML struct {
+	XMLName  xml.Name     `xml:"sitemapindex"`
+	NS       string       `xml:"xmlns,attr"`
+	Sitemaps []sitemapXML `xml:"sitemap"`
+}
+
+type sitemapXML struct {
+	Loc string `xml:"loc"`
+}
+
+// sitemapWriter writes a sitemaps.org sitemap of the pages on the root host that
+// were fetched successfully, as a sitemap may only list the pages of one host.
+// Past maxSitemapURLs pages the sitemap is split into files named after the
+// output file, and the output is a sitemap index of them.
+type sitemapWriter struct {
+	// name is the output file name, or "-" for stdout.
+	name string
+	// base is the URL the sitemap files are to be published under, which the
+	// index refers to them by. It defaults to the root of the crawled host.
+	base string
+	// max is the most URLs in a file, maxSitemapURLs if it is zero.
+	max int
+}
+
+func (s *sitemapWriter) Ext() string {
+	return "xml"
+}
+
+func (s *sitemapWriter) Write(w io.Writer, cr *crawler.Result) error {
+	root := cr.Root().URL()
+	max := s.max
+	if max <= 0 {
+		max = maxSitemapURLs
+	}
+	urls := sitemapEntries(cr.LookupTable(), root)
+	if len(urls) <= max {
+		return writeXML(w, newURLSet(urls))
+	}
+
+	base := &url.URL{Scheme: root.Scheme, Host: root.Host, Path: "/"}
+	if s.base != "" {
+		var err error
+		if base, err = url.Parse(s.base); err != nil {
+			return err
+		}
+	}
+	prefix := strings.TrimSuffix(s.name, filepath.Ext(s.name))
+	if s.name == "-" || s.name == "" {
+		prefix = root.Host
+	}
+	index := sitemapIndexXML{NS: sitemapNS}
+	for i := 0; i*max < len(urls); i++ {
+		part := urls[i*max:]
+		if len(part) > max {
+			part = part[:max]
+		}
+		name := fmt.Sprintf("%s-%d.%s", prefix, i+1, s.Ext())
+		f, err := os.Create(name)
+		if err != nil {
+			return err
+		}
+		err = writeXML(f, newURLSet(part))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+		loc, err := base.Parse(url.PathEscape(filepath.Base(name)))
+		if err != nil {
+			return err
+		}
+		index.Sitemaps = append(index.Sitemaps, sitemapXML{loc.String()})
+	}
+	return writeXML(w, index)
+}
+
+func newURLSet(urls []urlXML) urlsetXML {
+	set := urlsetXML{NS: sitemapNS, URLs: urls}
+	for _, u := range urls {
+		if len(u.Links) > 0 {
+			set.XHTMLNS = xhtmlNS
+			break
+		}
+	}
+	return set
+}
+
+// sitemapEntries returns the sitemap entries of the HTML pages on the scheme and
+// host of root that were fetched without error and may be indexed, sorted by URL.
+func sitemapEntries(pages map[string]crawler.PageRecord, root *url.URL) []urlXML {
+	var urls []urlXML
+	for u, pr := range pages {
+		if pr.Status != "" || pr.Error != "" || pr.NoIndex || !isHTML(pr.ContentType) {
+			continue
+		}
+		if pu, err := url.Parse(u); err != nil || pu.Scheme != root.Scheme || pu.Host != root.Host {
+			continue
+		}
+		entry := urlXML{Loc: u, LastMod: pr.LastModified}
+		for _, a := range pr.Alternates {
+			entry.Links = append(entry.Links, xhtmlLinkXML{"alternate", a.Lang, a.URL})
+		}
+		urls = append(urls, entry)
+	}
+	sort.Slice(urls, func(i, j int) bool { return urls[i].Loc < urls[j].Loc })
+	return urls
+}
+
+// isHTML reports whether a page with the content type ct is HTML. Pages without
+// a recorded content type are taken to be.
+func isHTML(ct string) bool {
+	if ct == "" {
+		return true
+	}
+	mt, _, _ := mime.ParseMediaType(ct)
+	return mt == "text/html" || mt == "application/xhtml+xml"
+}
+
+func writeXML(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	if *pretty {
+		enc.Indent("", "  ")
+	}
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
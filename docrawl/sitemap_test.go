@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jkl1337/docrawl/crawler"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSitemapEntries(t *testing.T) {
+	root, _ := url.Parse("http://testhost.local/")
+	pages := map[string]crawler.PageRecord{
+		"http://testhost.local/": {
+			ContentType:  "text/html; charset=utf-8",
+			LastModified: "2014-06-12T20:20:58Z",
+			Alternates:   []crawler.AlternateRecord{{Lang: "de", URL: "http://testhost.local/de/"}},
+		},
+		"http://testhost.local/de/":          {},
+		"http://testhost.local/broken.html":  {StatusCode: 404, Error: "non 200 status code received: 404"},
+		"http://testhost.local/old.html":     {Status: crawler.PageRedirect.String()},
+		"http://testhost.local/hidden.html":  {ContentType: "text/html", NoIndex: true},
+		"http://testhost.local/manual.pdf":   {ContentType: "application/pdf"},
+		"http://testhost.local/blocked.html": {Status: crawler.PageBlocked.String()},
+		"https://testhost.local/secure.html": {ContentType: "text/html"},
+		"http://sub.testhost.local/":         {ContentType: "text/html"},
+		"http://otherhost.local/":            {Status: crawler.PageExternal.String(), StatusCode: 200},
+	}
+
+	assert.Equal(t, []urlXML{
+		{Loc: "http://testhost.local/", LastMod: "2014-06-12T20:20:58Z",
+			Links: []xhtmlLinkXML{{"alternate", "de", "http://testhost.local/de/"}}},
+		{Loc: "http://testhost.local/de/"},
+	}, sitemapEntries(pages, root), "only the successful HTML pages of the root host are listed")
+}
+
+// sitemapSite serves a root page linking to n pages, each with a German
+// alternate, and crawls it.
+func sitemapSite(t *testing.T, n int) (*httptest.Server, *crawler.Result) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Last-Modified", "Thu, 12 Jun 2014 20:20:58 GMT")
+		if r.URL.Path != "/" {
+			fmt.Fprintf(w, `<html><head><link rel="alternate" hreflang="de" href="/de%s"></head></html>`, r.URL.Path)
+			return
+		}
+		var links []string
+		for i := 1; i <= n; i++ {
+			links = append(links, fmt.Sprintf(`<a href="/page%d.html">%d</a>`, i, i))
+		}
+		fmt.Fprintf(w, `<html><body>%s</body></html>`, strings.Join(links, ""))
+	}))
+	c := crawler.NewCrawler(2, nil)
+	c.Metadata = crawler.MetaAll
+	c.MaxDepth = 1
+	cr, err := c.Crawl(ts.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts, cr
+}
+
+func TestSitemapWriter(t *testing.T) {
+	ts, cr := sitemapSite(t, 1)
+	defer ts.Close()
+
+	var buf bytes.Buffer
+	assert.NoError(t, (&sitemapWriter{name: "-"}).Write(&buf, cr))
+	out := buf.String()
+	assert.True(t, strings.HasPrefix(out, `<?xml version="1.0" encoding="UTF-8"?>`))
+	assert.Contains(t, out, `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9" xmlns:xhtml="http://www.w3.org/1999/xhtml">`)
+	assert.Contains(t, out, `<url><loc>`+ts.URL+`/page1.html</loc><lastmod>2014-06-12T20:20:58Z</lastmod>`+
+		`<xhtml:link rel="alternate" hreflang="de" href="`+ts.URL+`/de/page1.html"></xhtml:link></url>`)
+
+	sm, err := crawler.ParseSitemap(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{ts.URL + "/", ts.URL + "/page1.html"}, sm.URLs)
+}
+
+func TestSitemapWriterSplit(t *testing.T) {
+	ts, cr := sitemapSite(t, 4)
+	defer ts.Close()
+	dir, err := ioutil.TempDir("", "docrawl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	readSitemap := func(name string) *crawler.Sitemap {
+		f, err := os.Open(name)
+		if !assert.NoError(t, err) {
+			return &crawler.Sitemap{}
+		}
+		defer f.Close()
+		sm, err := crawler.ParseSitemap(f)
+		assert.NoError(t, err)
+		return sm
+	}
+
+	// the root and four pages make three files of at most two
+	var buf bytes.Buffer
+	sw := &sitemapWriter{name: filepath.Join(dir, "site.xml"), base: "https://cdn.example.com/maps/", max: 2}
+	assert.NoError(t, sw.Write(&buf, cr))
+	index, err := crawler.ParseSitemap(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"https://cdn.example.com/maps/site-1.xml",
+		"https://cdn.example.com/maps/site-2.xml",
+		"https://cdn.example.com/maps/site-3.xml",
+	}, index.Sitemaps, "the index refers to the files under the base URL")
+
+	var listed []string
+	for i, n := range []int{2, 2, 1} {
+		sm := readSitemap(filepath.Join(dir, fmt.Sprintf("site-%d.xml", i+1)))
+		assert.Equal(t, n, len(sm.URLs))
+		listed = append(listed, sm.URLs...)
+	}
+	assert.Equal(t, []string{ts.URL + "/", ts.URL + "/page1.html", ts.URL + "/page2.html", ts.URL + "/page3.html", ts.URL + "/page4.html"}, listed)
+
+	buf.Reset()
+	sw = &sitemapWriter{name: filepath.Join(dir, "other.xml"), max: 3}
+	assert.NoError(t, sw.Write(&buf, cr))
+	index, err = crawler.ParseSitemap(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{ts.URL + "/other-1.xml", ts.URL + "/other-2.xml"}, index.Sitemaps, "the base defaults to the root of the host")
+}